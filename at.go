@@ -0,0 +1,95 @@
+package cereal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrATFailed is returned by [ATClient.Command] when the device replies with an error result code.
+var ErrATFailed = errors.New("AT command failed")
+
+// ATClient sends AT commands to modems and similar devices and reads back their responses.
+type ATClient struct {
+	nb          *NonBlocking
+	terminators []string
+	pending     []byte
+	status      string
+}
+
+// NewATClient returns an ATClient that sends commands over rwc. If rwc is not a [NonBlocking]
+// it is wrapped in one so that commands can time out. Commands succeed when the device replies "OK"
+// or any of the additional terminators given and fail on "ERROR", "+CME ERROR" or "+CMS ERROR" replies.
+func NewATClient(rwc io.ReadWriteCloser, terminators ...string) *ATClient {
+	nb, ok := rwc.(*NonBlocking)
+	if !ok {
+		nb = NewNonBlocking(rwc, NonBlockingConfig{})
+	}
+	return &ATClient{nb: nb, terminators: terminators}
+}
+
+// Command discards any unread input, sends cmd terminated by "\r\n" and reads response lines until a final
+// result code is received or the timeout expires. The intermediate lines are returned, excluding empty lines,
+// the command echo and the final result code which can be retrieved with Status.
+// If the final result code is an error the returned error wraps [ErrATFailed].
+func (at *ATClient) Command(cmd string, timeout time.Duration) (lines []string, err error) {
+	deadline := time.Now().Add(timeout)
+	at.nb.Reset()
+	at.pending = at.pending[:0]
+	at.status = ""
+	cmd = strings.TrimRight(cmd, "\r\n")
+	_, err = at.nb.WriteString(cmd + "\r\n")
+	if err != nil {
+		return nil, err
+	}
+	var buf [256]byte
+	for {
+		for {
+			idx := bytes.IndexByte(at.pending, '\n')
+			if idx < 0 {
+				break
+			}
+			line := strings.TrimSpace(string(at.pending[:idx]))
+			at.pending = at.pending[idx+1:]
+			switch {
+			case line == "" || line == cmd:
+				continue // Skip empty lines and echo.
+			case line == "OK" || at.isTerminator(line):
+				at.status = line
+				return lines, nil
+			case line == "ERROR" || strings.HasPrefix(line, "+CME ERROR") || strings.HasPrefix(line, "+CMS ERROR"):
+				at.status = line
+				return lines, fmt.Errorf("%w: %s", ErrATFailed, line)
+			}
+			lines = append(lines, line)
+		}
+		n, err := at.nb.readNext(buf[:], deadline)
+		if err != nil {
+			return lines, err
+		}
+		at.pending = append(at.pending, buf[:n]...)
+	}
+}
+
+// Status returns the final result code of the last command, i.e. "OK" or "ERROR".
+// It is empty if the last command did not receive a final result code.
+func (at *ATClient) Status() string {
+	return at.status
+}
+
+// Close closes the underlying port.
+func (at *ATClient) Close() error {
+	return at.nb.Close()
+}
+
+func (at *ATClient) isTerminator(line string) bool {
+	for _, t := range at.terminators {
+		if line == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package cereal
+
+// setReadBufferSize is not supported: POSIX terminals have no interface to resize the driver buffers.
+func setReadBufferSize(fd uintptr, size int) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package cereal
+
+import "syscall"
+
+var procSetupComm = syscall.NewLazyDLL("kernel32.dll").NewProc("SetupComm")
+
+// setReadBufferSize sets the recommended sizes of the driver's input and output queues.
+func setReadBufferSize(fd uintptr, size int) error {
+	r, _, err := procSetupComm.Call(fd, uintptr(size), uintptr(size))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cereal
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// BusArbiter serializes request/response transactions from multiple goroutines over a single
+// port on a shared bus, such as an RS-485 multidrop bus where only one master may talk at a time.
+// A minimum gap of silence is kept between the end of a transaction and the start of the next
+// so that slaves may finish responding and the bus may settle.
+type BusArbiter struct {
+	nb  *NonBlocking
+	gap time.Duration
+	mu  sync.Mutex
+	// lastEnd is the time the last transaction ended.
+	lastEnd time.Time
+}
+
+// NewBusArbiter returns a BusArbiter transacting over nb. gap is the minimum silence between
+// transactions and is also the silence after which a response is considered complete,
+// similar to the inter-frame delay of Modbus RTU. gap must be greater than zero.
+func NewBusArbiter(nb *NonBlocking, gap time.Duration) *BusArbiter {
+	if nb == nil {
+		panic("nil NonBlocking passed into NewBusArbiter")
+	} else if gap <= 0 {
+		panic("invalid gap duration")
+	}
+	return &BusArbiter{nb: nb, gap: gap}
+}
+
+// Transact waits for its turn on the bus, discards any stale buffered data and writes req.
+// It then waits up to timeout for the first byte of the response and reads the response
+// until the bus has been silent for the arbiter's gap. The timeout includes the time taken
+// to transmit req. If no response is received within the timeout an error is returned.
+//
+// Transactions from concurrent callers never overlap and are performed in roughly the order
+// the callers arrived.
+func (ba *BusArbiter) Transact(req []byte, timeout time.Duration) (resp []byte, err error) {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
+	time.Sleep(time.Until(ba.lastEnd.Add(ba.gap)))
+	defer func() { ba.lastEnd = time.Now() }()
+	ba.nb.Reset()
+	_, err = ba.nb.Write(req)
+	if err != nil {
+		return nil, err
+	}
+	var buf [256]byte
+	n, err := ba.nb.readNext(buf[:], time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+	rbuf := bytes.NewBuffer(append([]byte(nil), buf[:n]...))
+	_, err = CopyUntilIdle(rbuf, ba.nb, ba.gap)
+	return rbuf.Bytes(), err
+}
@@ -0,0 +1,76 @@
+package cereal
+
+import "runtime"
+
+// Capabilities describes the [Mode] settings an Opener supports on the current platform.
+// It allows a program to pick a backend for a given Mode without hardcoding each backend's limitations.
+// Opening a port with a Mode that requires an unsupported capability fails with an error
+// wrapping [ErrNotSupported] before the port is opened.
+type Capabilities struct {
+	// SupportsReadTimeout is true if a non-zero Mode.ReadTimeout is supported.
+	SupportsReadTimeout bool
+	// SupportsMarkSpaceParity is true if ParityMark and ParitySpace are supported.
+	SupportsMarkSpaceParity bool
+	// Supports1HalfStopBits is true if StopBits1Half is supported.
+	Supports1HalfStopBits bool
+	// SupportsFlowControl is true if the Opener can enable hardware (RTS/CTS) flow control.
+	// None of the Openers in this package currently do.
+	SupportsFlowControl bool
+	// RequiresCGO is true if the backend requires cgo. See the Opener's Available method.
+	RequiresCGO bool
+}
+
+// Supports reports whether mode can be used with an Opener with the capabilities c.
+func (c Capabilities) Supports(mode Mode) bool {
+	return c.check(mode) == nil
+}
+
+// check returns an error wrapping ErrNotSupported if mode requires a capability not in c.
+func (c Capabilities) check(mode Mode) error {
+	switch {
+	case mode.ReadTimeout != 0 && !c.SupportsReadTimeout:
+		return errUnsupportedReadTimeout
+	case (mode.Parity == ParityMark || mode.Parity == ParitySpace) && !c.SupportsMarkSpaceParity:
+		return errUnsupportedParity
+	case mode.StopBits == StopBits1Half && !c.Supports1HalfStopBits:
+		return errUnsupportedStopbits
+	}
+	return nil
+}
+
+// Capabilities returns the Mode settings supported by bugst on the current platform.
+func (Bugst) Capabilities() Capabilities {
+	return Capabilities{
+		SupportsMarkSpaceParity: runtime.GOOS == "linux" || runtime.GOOS == "windows",
+		Supports1HalfStopBits:   runtime.GOOS == "windows",
+	}
+}
+
+// Capabilities returns the Mode settings supported by tarm on the current platform.
+func (Tarm) Capabilities() Capabilities {
+	return Capabilities{
+		SupportsReadTimeout:     true,
+		SupportsMarkSpaceParity: runtime.GOOS == "windows",
+		Supports1HalfStopBits:   runtime.GOOS == "windows",
+	}
+}
+
+// Capabilities returns the Mode settings supported by goburrow on the current platform.
+func (Goburrow) Capabilities() Capabilities {
+	return Capabilities{SupportsReadTimeout: true}
+}
+
+// Capabilities returns the Mode settings supported by sers on the current platform.
+func (Sers) Capabilities() Capabilities {
+	return Capabilities{SupportsReadTimeout: true, RequiresCGO: true}
+}
+
+// Capabilities returns the Mode settings supported by termios on the current platform.
+// Note 1.5 stop bits are only supported with 5 data bits.
+func (Termios) Capabilities() Capabilities {
+	return Capabilities{
+		SupportsReadTimeout:     termiosAvailable,
+		SupportsMarkSpaceParity: termiosAvailable && runtime.GOOS == "linux",
+		Supports1HalfStopBits:   termiosAvailable,
+	}
+}
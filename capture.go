@@ -0,0 +1,318 @@
+package cereal
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of traffic in a capture.
+type Direction byte
+
+const (
+	// DirRead is data read from the port, i.e. sent by the device.
+	DirRead Direction = 'R'
+	// DirWrite is data written to the port, i.e. sent to the device.
+	DirWrite Direction = 'W'
+)
+
+// String returns a human readable representation of the direction.
+func (d Direction) String() (s string) {
+	switch d {
+	case DirRead:
+		s = "read"
+	case DirWrite:
+		s = "write"
+	default:
+		s = "<invalid direction>"
+	}
+	return s
+}
+
+// captureHeaderLen is the length of a capture record header:
+// 8 byte unix nanosecond timestamp, 1 byte direction and 4 byte data length, all big endian.
+const captureHeaderLen = 8 + 1 + 4
+
+// maxCaptureData is the maximum data length of a capture record. Longer data is split into several
+// records by the Recorder so that a corrupt length does not make CaptureReader allocate gigabytes.
+const maxCaptureData = 1 << 20
+
+var errInvalidCapture = errors.New("invalid capture record")
+
+// CaptureRecord is a single timestamped chunk of traffic in a capture.
+type CaptureRecord struct {
+	Time time.Time
+	Dir  Direction
+	Data []byte
+}
+
+// Recorder wraps an io.ReadWriteCloser and records all traffic read and written
+// through it to a capture writer. Data is passed through unmodified.
+//
+// Each record in the capture is a 13 byte header followed by the data:
+// an 8 byte big endian unix nanosecond timestamp, a 1 byte [Direction]
+// and a 4 byte big endian data length of at most 1 MiB; data read or written at once
+// that is longer is split into several records. Use [CaptureReader] to read a capture.
+type Recorder struct {
+	rwc io.ReadWriteCloser
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder returns a Recorder that passes data through rwc and records it to capture.
+func NewRecorder(rwc io.ReadWriteCloser, capture io.Writer) *Recorder {
+	if rwc == nil || capture == nil {
+		panic("nil argument to NewRecorder")
+	}
+	return &Recorder{rwc: rwc, w: capture}
+}
+
+// Read reads from the underlying port and records the data read.
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.rwc.Read(b)
+	if n > 0 {
+		r.record(DirRead, b[:n])
+	}
+	return n, err
+}
+
+// Write writes to the underlying port and records the data written.
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.rwc.Write(b)
+	if n > 0 {
+		r.record(DirWrite, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the underlying port. It does not close the capture writer.
+func (r *Recorder) Close() error {
+	return r.rwc.Close()
+}
+
+// Err returns the first error encountered writing to the capture writer.
+// Capture errors do not interrupt traffic through the Recorder. After an
+// error no more records are written.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(dir Direction, data []byte) {
+	now := time.Now().UnixNano()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(data) > 0 && r.err == nil {
+		chunk := data
+		if len(chunk) > maxCaptureData {
+			chunk = chunk[:maxCaptureData]
+		}
+		data = data[len(chunk):]
+		var hdr [captureHeaderLen]byte
+		binary.BigEndian.PutUint64(hdr[0:8], uint64(now))
+		hdr[8] = byte(dir)
+		binary.BigEndian.PutUint32(hdr[9:13], uint32(len(chunk)))
+		_, r.err = r.w.Write(hdr[:])
+		if r.err == nil {
+			_, r.err = r.w.Write(chunk)
+		}
+	}
+}
+
+// HexDump returns a port that passes data through port unmodified while writing a human readable
+// hex dump of the traffic to w, which is handy for interactive debugging of binary protocols.
+// Each chunk read or written is dumped as a line with its time, [Direction] and length followed by
+// the output of [hex.Dump]:
+//
+//	15:04:05.000000 W 5
+//	00000000  68 65 6c 6c 6f                                    |hello|
+//
+// Errors writing to w do not interrupt traffic; after an error no more dumps are written.
+// Use a [Recorder] to capture traffic for later replay. Close does not close w.
+func HexDump(port io.ReadWriteCloser, w io.Writer) io.ReadWriteCloser {
+	if port == nil || w == nil {
+		panic("nil argument to HexDump")
+	}
+	return &hexDumpPort{ReadWriteCloser: port, w: w}
+}
+
+type hexDumpPort struct {
+	io.ReadWriteCloser
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (hp *hexDumpPort) Underlying() io.ReadWriteCloser { return hp.ReadWriteCloser }
+
+func (hp *hexDumpPort) Read(b []byte) (int, error) {
+	n, err := hp.ReadWriteCloser.Read(b)
+	if n > 0 {
+		hp.dump(DirRead, b[:n])
+	}
+	return n, err
+}
+
+func (hp *hexDumpPort) Write(b []byte) (int, error) {
+	n, err := hp.ReadWriteCloser.Write(b)
+	if n > 0 {
+		hp.dump(DirWrite, b[:n])
+	}
+	return n, err
+}
+
+func (hp *hexDumpPort) dump(dir Direction, data []byte) {
+	line := time.Now().Format("15:04:05.000000") + " " + string(dir) + " " + strconv.Itoa(len(data)) + "\n"
+	line += hex.Dump(data)
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	if hp.err == nil {
+		_, hp.err = io.WriteString(hp.w, line)
+	}
+}
+
+// CaptureReader reads records written by a [Recorder].
+type CaptureReader struct {
+	r io.Reader
+}
+
+// NewCaptureReader returns a CaptureReader reading records from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: r}
+}
+
+// Next returns the next record in the capture. It returns io.EOF when there are no more records.
+// A capture truncated in the middle of a record returns io.ErrUnexpectedEOF and a record
+// with an invalid direction or a data length over 1 MiB, i.e. due to corruption, an error.
+func (cr *CaptureReader) Next() (CaptureRecord, error) {
+	var hdr [captureHeaderLen]byte
+	_, err := io.ReadFull(cr.r, hdr[:])
+	if err != nil {
+		return CaptureRecord{}, err
+	}
+	dir := Direction(hdr[8])
+	length := binary.BigEndian.Uint32(hdr[9:13])
+	if (dir != DirRead && dir != DirWrite) || length > maxCaptureData {
+		return CaptureRecord{}, errInvalidCapture
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(cr.r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return CaptureRecord{}, err
+	}
+	return CaptureRecord{
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(hdr[0:8]))),
+		Dir:  dir,
+		Data: data,
+	}, nil
+}
+
+// NewReplayPort returns a port that plays back the data read in a capture written by a [Recorder],
+// preserving the original timing between records. Written data is discarded but recorded
+// writes act as synchronization points: playback does not advance past a recorded write
+// until the same amount of bytes has been written to the port, so that responses are not
+// played back before the request that caused them.
+//
+// Like a port with no read timeout, Read blocks until the next recorded data is due.
+// Wrap the port in a [NonBlocking] for timeout semantics. Read returns io.EOF after the end of
+// the capture is reached or after the port is closed, which interrupts a Read that is waiting.
+func NewReplayPort(capture io.Reader) io.ReadWriteCloser {
+	rp := &replayPort{cr: NewCaptureReader(capture), done: make(chan struct{})}
+	rp.cond.L = &rp.mu
+	return rp
+}
+
+type replayPort struct {
+	cr   *CaptureReader
+	mu   sync.Mutex
+	cond sync.Cond
+	// written is the amount of bytes written and not yet matched to a recorded write.
+	written int
+	closed  bool
+	// done is closed on Close to interrupt a Read waiting for the next record to be due.
+	done    chan struct{}
+	pending []byte
+	// lastRec is the capture time of the last record played back and lastWall the time it was played.
+	lastRec  time.Time
+	lastWall time.Time
+	err      error
+}
+
+func (rp *replayPort) Read(b []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for len(rp.pending) == 0 {
+		if rp.closed {
+			return 0, io.EOF
+		} else if rp.err != nil {
+			return 0, rp.err
+		}
+		rec, err := rp.cr.Next()
+		if err != nil {
+			rp.err = err
+			continue
+		}
+		if rp.lastWall.IsZero() {
+			rp.lastRec = rec.Time
+			rp.lastWall = time.Now()
+		}
+		switch rec.Dir {
+		case DirWrite:
+			for rp.written < len(rec.Data) && !rp.closed {
+				rp.cond.Wait()
+			}
+			rp.written -= len(rec.Data)
+			rp.lastWall = time.Now()
+		case DirRead:
+			due := rp.lastWall.Add(rec.Time.Sub(rp.lastRec))
+			rp.mu.Unlock()
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-timer.C:
+			case <-rp.done:
+				timer.Stop()
+			}
+			rp.mu.Lock()
+			if rp.closed {
+				return 0, io.EOF
+			}
+			rp.lastWall = due
+			rp.pending = rec.Data
+		}
+		rp.lastRec = rec.Time
+	}
+	n := copy(b, rp.pending)
+	rp.pending = rp.pending[n:]
+	return n, nil
+}
+
+func (rp *replayPort) Write(b []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.closed {
+		return 0, io.ErrClosedPipe
+	}
+	rp.written += len(b)
+	rp.cond.Broadcast()
+	return len(b), nil
+}
+
+func (rp *replayPort) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if !rp.closed {
+		rp.closed = true
+		close(rp.done)
+	}
+	rp.cond.Broadcast()
+	return nil
+}
@@ -1,9 +1,18 @@
 package cereal
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/distributed/sers"
 	goburrow "github.com/goburrow/serial"
@@ -13,40 +22,242 @@ import (
 	"go.bug.st/serial/enumerator"
 )
 
+// ErrNotSupported is returned when a functionality is not supported by
+// the port, backend or platform.
+var ErrNotSupported = errors.New("cereal: not supported")
+
+// ErrPortNotFound is returned when searching for a port that is not connected.
+var ErrPortNotFound = errors.New("cereal: port not found")
+
+// ErrPortBusy is returned when opening a port with [Mode.Exclusive] set
+// and the port is already held by another process.
+var ErrPortBusy = errors.New("cereal: port busy")
+
+// ErrWriteTimeout is returned by ports opened with a non-zero [Mode.WriteTimeout]
+// when a write does not complete within the timeout. Like read timeouts it satisfies
+// errors.Is(err, os.ErrDeadlineExceeded) and implements net.Error.
+var ErrWriteTimeout error = &timeoutError{msg: "cereal: write timeout"}
+
+// ErrReadTimeout is returned by ports opened with a non-zero [Mode.ReadTimeout] when no data
+// is received within the timeout. Like ErrWriteTimeout it satisfies errors.Is(err, os.ErrDeadlineExceeded)
+// and implements net.Error. The port remains usable: the next Read waits for data again.
+var ErrReadTimeout error = &timeoutError{msg: "cereal: read timeout"}
+
+// timeoutError is returned when a deadline or timeout passes. It wraps os.ErrDeadlineExceeded so it
+// can be checked for like the timeouts of the standard library, and implements net.Error with
+// Timeout and Temporary returning true so retry loops written against net.Error work unchanged.
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Unwrap() error   { return os.ErrDeadlineExceeded }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
 // Opener is an interface for working with serial port libraries to be able
 // to easily interchange them.
 //
 // It is implemented by the various serial port libraries in this package for convenience.
+// The ports they return wrap the backend's port to remember their name, see [PortName], so they
+// can't be type asserted to the backend's port type, i.e. *serial.Port of tarm. Use [Unwrap] to
+// access the backend's port and its specific methods.
 type Opener interface {
 	// OpenPort opens a serial port with the given name and mode.
 	// portname is the name of the port to open, e.g. "/dev/ttyUSB0" or "COM1".
 	OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error)
 }
 
+// OpenerContext is implemented by Openers that can abort opening a port
+// when the context is cancelled.
+type OpenerContext interface {
+	// OpenPortContext opens a serial port with the given name and mode. If ctx is
+	// cancelled before the port is opened the open is aborted and ctx.Err() is returned.
+	OpenPortContext(ctx context.Context, portname string, mode Mode) (io.ReadWriteCloser, error)
+}
+
+// OpenPortContext opens a port using o and returns early with ctx.Err() if ctx is cancelled
+// before the port is opened. If o implements [OpenerContext] its OpenPortContext method is used.
+//
+// None of the backends in this package can interrupt an open in progress, so for those the
+// blocking OpenPort call is run in a separate goroutine that is abandoned on cancellation.
+// The abandoned goroutine lives until OpenPort returns, which could be never if the OS call
+// is stuck. If the abandoned OpenPort eventually succeeds the port is closed.
+func OpenPortContext(ctx context.Context, o Opener, portname string, mode Mode) (io.ReadWriteCloser, error) {
+	if oc, ok := o.(OpenerContext); ok {
+		return oc.OpenPortContext(ctx, portname, mode)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		port io.ReadWriteCloser
+		err  error
+	}
+	done := make(chan result)
+	abandon := make(chan struct{})
+	go func() {
+		port, err := o.OpenPort(portname, mode)
+		select {
+		case done <- result{port: port, err: err}:
+		case <-abandon:
+			if err == nil {
+				port.Close() // Nobody is waiting on port, close it to release resources.
+			}
+		}
+	}()
+	select {
+	case res := <-done:
+		return res.port, res.err
+	case <-ctx.Done():
+		close(abandon)
+		// Open may have finished at the same time the context was cancelled.
+		select {
+		case res := <-done:
+			if res.err == nil {
+				res.port.Close()
+			}
+		default:
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// OpenWithTimeout opens a port with o, making mode.ReadTimeout work regardless of backend. If o reports
+// through a `Capabilities() Capabilities` method that it does not support a read timeout, such as [Bugst],
+// the port is opened with a zero ReadTimeout and read by a [NonBlocking] that implements the timeout with
+// the semantics documented on [Mode.ReadTimeout]. Otherwise the port is opened as with o.OpenPort.
+func OpenWithTimeout(o Opener, portname string, mode Mode) (io.ReadWriteCloser, error) {
+	c, ok := o.(interface{ Capabilities() Capabilities })
+	if mode.ReadTimeout == 0 || !ok || c.Capabilities().SupportsReadTimeout {
+		return o.OpenPort(portname, mode)
+	}
+	timeout := mode.ReadTimeout
+	mode.ReadTimeout = 0
+	port, err := o.OpenPort(portname, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &nonBlockingTimeoutPort{NonBlocking: NewNonBlocking(port, NonBlockingConfig{}), timeout: timeout}, nil
+}
+
+// nonBlockingTimeoutPort implements [Mode.ReadTimeout] for ports without read timeout support.
+// Unlike [NonBlocking.Read] with a ReadTimeout its Read returns as soon as any data is buffered.
+type nonBlockingTimeoutPort struct {
+	*NonBlocking
+	timeout time.Duration
+}
+
+func (tp *nonBlockingTimeoutPort) Underlying() io.ReadWriteCloser { return tp.NonBlocking }
+
+func (tp *nonBlockingTimeoutPort) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	deadline := time.Now().Add(tp.timeout)
+	for {
+		n, err := tp.readNext(b, deadline)
+		if err == errDeadlineExceeded {
+			return 0, ErrReadTimeout
+		} else if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
 // PortDetails contains OS provided information on a USB or Serial port.
 type PortDetails struct {
 	Name     string
 	VID, PID uint16
 	IsUSB    bool
+	// StableName is a name for the port that does not change across reboots or reconnections,
+	// such as a /dev/serial/by-id path on Linux. Empty if the platform does not provide one.
+	StableName string
+	// LocationID identifies the physical USB port the device is connected to, such as "1-2.3" on Linux
+	// for port 3 of the hub connected to port 2 of bus 1. It allows telling identical adapters apart
+	// regardless of enumeration order. Empty if the platform does not provide it or for non-USB ports.
+	LocationID string
+	// Interface is the USB interface number of the port within its USB device. Composite devices
+	// expose several ports on one device with the same VID and PID, i.e. a JTAG and a UART interface,
+	// which are told apart by their interface number. -1 if the platform does not provide it or for non-USB ports.
+	Interface int
 }
 
 // ForEachPort calls the given function for each serial port found.
 //
 // ForEachPort returns early with fn's error if fn returns an error or
 // if halt is true.
+//
+// Ports are enumerated with both a detailed and a simple method. If the detailed
+// enumeration fails the ports from the simple enumeration are still reported with only their
+// Name set. An error is returned only if both enumeration methods fail.
 func ForEachPort(fn func(details PortDetails) (halt bool, err error)) error {
-	detailedList, err := enumerator.GetDetailedPortsList()
+	ports, err := listPorts()
 	if err != nil {
 		return err
 	}
+	for _, port := range ports {
+		halt, err := fn(port)
+		if err != nil || halt {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachPortContext is like [ForEachPort] but returns ctx.Err() if ctx is cancelled before
+// the enumeration completes, since on some systems enumeration can hang for seconds.
+// fn is not called after ctx is cancelled.
+//
+// The enumeration runs in a separate goroutine that is abandoned on cancellation.
+// The abandoned goroutine lives until the OS calls return, which could be never if they are stuck.
+func ForEachPortContext(ctx context.Context, fn func(details PortDetails) (halt bool, err error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	type result struct {
+		ports []PortDetails
+		err   error
+	}
+	done := make(chan result, 1) // Buffered so an abandoned enumeration does not block forever.
+	go func() {
+		ports, err := listPorts()
+		done <- result{ports: ports, err: err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.err != nil {
+		return res.err
+	}
+	for _, port := range res.ports {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		halt, err := fn(port)
+		if err != nil || halt {
+			return err
+		}
+	}
+	return nil
+}
 
+// listPorts enumerates the serial ports. See ForEachPort.
+func listPorts() ([]PortDetails, error) {
+	detailedList, detailedErr := enumerator.GetDetailedPortsList()
 	// Add missing non-detailed to the list of detailed ports. On windows COM ports may be missing.
-	simpleList, err := bugst.GetPortsList()
-	if err == nil {
+	simpleList, simpleErr := bugst.GetPortsList()
+	if detailedErr != nil && simpleErr != nil {
+		return nil, errors.Join(detailedErr, simpleErr)
+	}
+	if simpleErr == nil {
 		for _, portname := range simpleList {
 			contained := false
 			for _, detailedPort := range detailedList {
-				if detailedPort.Name == portname {
+				if SamePortName(detailedPort.Name, portname) {
 					contained = true
 					break
 				}
@@ -56,20 +267,137 @@ func ForEachPort(fn func(details PortDetails) (halt bool, err error)) error {
 			}
 		}
 	}
+	stableNames := stablePortNames()
+	ports := make([]PortDetails, 0, len(detailedList))
 	for _, port := range detailedList {
 		vid, _ := strconv.ParseUint(port.VID, 16, 16)
 		pid, _ := strconv.ParseUint(port.PID, 16, 16)
-		halt, err := fn(PortDetails{
-			Name:  port.Name,
-			VID:   uint16(vid),
-			PID:   uint16(pid),
-			IsUSB: port.IsUSB,
+		ports = append(ports, PortDetails{
+			Name:       port.Name,
+			VID:        uint16(vid),
+			PID:        uint16(pid),
+			IsUSB:      port.IsUSB,
+			StableName: stableNames[port.Name],
+			LocationID: usbLocation(port.Name),
+			Interface:  usbInterfaceNumber(port.Name),
 		})
-		if err != nil || halt {
-			return err
+	}
+	return ports, nil
+}
+
+// FindPort returns the details of the first port for which match returns true and found set to true.
+// If no port matches found is false and the error is nil. An error is returned only if the ports
+// could not be enumerated, see [ForEachPort].
+func FindPort(match func(details PortDetails) bool) (details PortDetails, found bool, err error) {
+	err = ForEachPort(func(port PortDetails) (bool, error) {
+		if match(port) {
+			details, found = port, true
 		}
+		return found, nil
+	})
+	return details, found, err
+}
+
+// PortFilter reports whether a port should be selected, see [OpenAllMatching].
+type PortFilter func(details PortDetails) bool
+
+// MatchUSB returns a PortFilter selecting the USB ports with the given VID and PID.
+func MatchUSB(vid, pid uint16) PortFilter {
+	return func(details PortDetails) bool {
+		return details.IsUSB && details.VID == vid && details.PID == pid
 	}
-	return nil
+}
+
+// OpenAllMatching opens with o and mode every port selected by filter, i.e. all identical devices of
+// a test rig, and returns them keyed by port name. If no port matches an empty map is returned.
+//
+// Opening is all or nothing: if any port fails to open, the ports already opened are closed and
+// a nil map is returned with the errors of all failed opens joined, each prefixed by its port name.
+// Ports are opened one after the other so a single hanging open delays the rest.
+func OpenAllMatching(o Opener, filter PortFilter, mode Mode) (map[string]io.ReadWriteCloser, error) {
+	var names []string
+	err := ForEachPort(func(details PortDetails) (bool, error) {
+		if filter(details) {
+			names = append(names, details.Name)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ports := make(map[string]io.ReadWriteCloser, len(names))
+	var errs []error
+	for _, name := range names {
+		port, err := o.OpenPort(name, mode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		ports[name] = port
+	}
+	if len(errs) > 0 {
+		for _, port := range ports {
+			port.Close()
+		}
+		return nil, errors.Join(errs...)
+	}
+	return ports, nil
+}
+
+// FindUSBInterface returns the name of the port exposed by interface iface of the USB device
+// with the given VID and PID, i.e. the UART of a composite USB device that also exposes a JTAG port.
+// If several such devices are connected the first one found is returned; use [ForEachPort]
+// and PortDetails.LocationID to tell them apart. FindUSBInterface returns an error wrapping
+// [ErrPortNotFound] if there is no such port, which is always the case on platforms that do
+// not report interface numbers.
+func FindUSBInterface(vid, pid uint16, iface int) (string, error) {
+	port, found, err := FindPort(func(port PortDetails) bool {
+		return port.IsUSB && port.VID == vid && port.PID == pid && port.Interface == iface
+	})
+	if err != nil {
+		return "", err
+	} else if !found {
+		return "", fmt.Errorf("%w: USB device %04x:%04x interface %d", ErrPortNotFound, vid, pid, iface)
+	}
+	return port.Name, nil
+}
+
+// SamePortName reports whether a and b name the same port. On Windows port names
+// are compared case-insensitively and the \\.\ device namespace prefix is ignored,
+// so "COM3", "com3" and `\\.\COM3` are the same port. On other platforms
+// names must match exactly.
+func SamePortName(a, b string) bool {
+	if runtime.GOOS != "windows" {
+		return a == b
+	}
+	return strings.EqualFold(trimDevicePrefix(a), trimDevicePrefix(b))
+}
+
+// DevicePath returns the path used to open the port name. On Windows the \\.\ device
+// namespace prefix is added if missing since it is required to open ports COM10 and above,
+// i.e. "COM10" becomes `\\.\COM10`. On other platforms name is returned unchanged.
+// All Openers in this package call DevicePath so names may be given with or without the prefix.
+func DevicePath(name string) string {
+	if runtime.GOOS != "windows" || strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\` + name
+}
+
+// trimDevicePrefix removes the Windows \\.\ device namespace prefix from name.
+func trimDevicePrefix(name string) string {
+	return strings.TrimPrefix(name, `\\.\`)
+}
+
+// ResolvePortName resolves symbolic links in name to the real device node, i.e. a
+// /dev/serial/by-id/ or /dev/serial/by-path/ link on Linux resolves to a /dev/ttyUSBx device.
+// This allows configuration files to refer to ports by a name that survives reboots.
+// On Windows name is returned unchanged since COM port names are not files.
+func ResolvePortName(name string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return name, nil
+	}
+	return filepath.EvalSymlinks(name)
 }
 
 // Bugst implements the Opener interface for the go.bug.st/serial package.
@@ -77,11 +405,67 @@ type Bugst struct{}
 
 func (Bugst) String() string      { return "bugst" }
 func (Bugst) PackagePath() string { return "go.bug.st/serial" }
+func (Bugst) Available() bool     { return true }
 
 func (Bugst) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
-	if mode.ReadTimeout != 0 {
-		return nil, errReadTimeoutUnsupportedBugst
+	mode, err := prepareMode(Bugst{}.Capabilities(), mode)
+	if err != nil {
+		return nil, err
+	}
+	bmode, err := bugstMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	devfd, err := openDeviceIf(needsDevice(mode), DevicePath(portname))
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "windows" {
+		portname = trimDevicePrefix(portname) // bugst always adds the prefix itself.
+	}
+	port, err := bugst.Open(portname, bmode)
+	if err != nil {
+		closeDevice(devfd)
+		return nil, openError(err)
+	}
+	return finishOpen(withDevice(&bugstPort{Port: port, mode: mode}, devfd), portname, mode)
+}
+
+// bugstPort is a port opened by the Bugst Opener. It records the mode of the port
+// since go.bug.st/serial has no way of querying it.
+type bugstPort struct {
+	bugst.Port
+	mu   sync.Mutex
+	mode Mode
+}
+
+// setMode reconfigures the port with the mode returned by change for its current mode,
+// once pending output has been transmitted.
+func (bp *bugstPort) setMode(change func(Mode) Mode) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	mode, err := prepareMode(Bugst{}.Capabilities(), change(bp.mode))
+	if err != nil {
+		return err
+	}
+	bmode, err := bugstMode(mode)
+	if err != nil {
+		return err
+	}
+	err = bp.Drain()
+	if err != nil {
+		return err
+	}
+	err = bp.Port.SetMode(bmode)
+	if err != nil {
+		return err
 	}
+	bp.mode = mode
+	return nil
+}
+
+// bugstMode converts mode to a go.bug.st/serial mode.
+func bugstMode(mode Mode) (*bugst.Mode, error) {
 	var parity bugst.Parity
 	switch mode.Parity {
 	case ParityNone:
@@ -109,12 +493,12 @@ func (Bugst) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
 	default:
 		return nil, errInvalidStopbits
 	}
-	return bugst.Open(portname, &bugst.Mode{
+	return &bugst.Mode{
 		BaudRate: mode.BaudRate,
 		DataBits: mode.DataBits,
 		Parity:   parity,
 		StopBits: stopbits,
-	})
+	}, nil
 }
 
 // Tarm implements the Opener interface for the github.com/tarm/serial package.
@@ -122,14 +506,27 @@ type Tarm struct{}
 
 func (Tarm) String() string      { return "tarm" }
 func (Tarm) PackagePath() string { return "github.com/tarm/serial" }
+func (Tarm) Available() bool     { return true }
 
 func (Tarm) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
-	var parity tarm.Parity = tarm.Parity(mode.Parity.Char())
-	return tarm.OpenPort(&tarm.Config{
-		Name:        portname,
+	mode, err := prepareMode(Tarm{}.Capabilities(), mode)
+	if err != nil {
+		return nil, err
+	}
+	parity, err := mode.Parity.CharErr()
+	if err != nil {
+		return nil, err
+	}
+	// tarm reports a hang up as it does a read timeout, which is told apart using a descriptor.
+	devfd, err := openDeviceIf(needsDevice(mode) || mode.ReadTimeout > 0, DevicePath(portname))
+	if err != nil {
+		return nil, err
+	}
+	port, err := tarm.OpenPort(&tarm.Config{
+		Name:        DevicePath(portname),
 		Baud:        mode.BaudRate,
 		Size:        byte(mode.DataBits),
-		Parity:      parity,
+		Parity:      tarm.Parity(parity),
 		ReadTimeout: mode.ReadTimeout,
 		StopBits: func() tarm.StopBits {
 			switch mode.StopBits {
@@ -144,6 +541,11 @@ func (Tarm) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
 			}
 		}(),
 	})
+	if err != nil {
+		closeDevice(devfd)
+		return nil, openError(err)
+	}
+	return finishOpen(withDevice(port, devfd), portname, mode)
 }
 
 // Goburrow implements the Opener interface for the github.com/goburrow/serial package.
@@ -151,20 +553,54 @@ type Goburrow struct{}
 
 func (Goburrow) String() string      { return "goburrow" }
 func (Goburrow) PackagePath() string { return "github.com/goburrow/serial" }
+func (Goburrow) Available() bool     { return true }
 
 func (Goburrow) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
-	if mode.StopBits == StopBits1Half {
+	mode, err := prepareMode(Goburrow{}.Capabilities(), mode)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := goburrowConfig(portname, mode)
+	if err != nil {
+		return nil, err
+	}
+	devfd, err := openDeviceIf(needsDevice(mode), cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := goburrow.Open(cfg)
+	if err != nil {
+		closeDevice(devfd)
+		return nil, openError(err)
+	}
+	return finishOpen(withDevice(port, devfd), portname, mode)
+}
+
+// goburrowConfig converts mode to a github.com/goburrow/serial config.
+func goburrowConfig(portname string, mode Mode) (*goburrow.Config, error) {
+	parity, err := mode.Parity.CharErr()
+	if err != nil {
+		return nil, err
+	}
+	var stopbits int
+	switch mode.StopBits {
+	case StopBits1:
+		stopbits = 1
+	case StopBits2:
+		stopbits = 2
+	case StopBits1Half:
 		return nil, errUnsupportedStopbits
+	default:
+		return nil, errInvalidStopbits
 	}
-	return goburrow.Open(&goburrow.Config{
-		Address:  portname,
+	return &goburrow.Config{
+		Address:  DevicePath(portname),
 		BaudRate: mode.BaudRate,
 		DataBits: mode.DataBits,
-		StopBits: mode.StopBits.Halves() / 2,
-		Parity:   string(mode.Parity.Char()),
+		StopBits: stopbits,
+		Parity:   string(parity),
 		Timeout:  mode.ReadTimeout,
-	})
-
+	}, nil
 }
 
 // Sers implements the Opener interface for the github.com/distributed/sers package.
@@ -173,49 +609,395 @@ type Sers struct{}
 func (Sers) String() string      { return "sers" }
 func (Sers) PackagePath() string { return "github.com/distributed/sers" }
 
+// Available reports whether the backend can open ports in the current build.
+// sers requires cgo so it is false when building with CGO_ENABLED=0.
+func (Sers) Available() bool { return sersAvailable }
+
 func (Sers) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
-	sp, err := openSers(portname)
+	mode, err := prepareMode(Sers{}.Capabilities(), mode)
 	if err != nil {
 		return nil, err
 	}
+	smode, err := sersMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	sp, fd, err := openSers(DevicePath(portname), mode.ReadTimeout != 0)
+	if err != nil {
+		return nil, openError(err)
+	}
 	if mode.ReadTimeout != 0 {
 		err = sp.SetReadParams(0, mode.ReadTimeout.Seconds())
 		if err != nil {
+			sp.Close()
 			return nil, err
 		}
 	}
-	var parity, stopbits, databits int
-	if databits == 0 {
-		databits = 8
+	err = sers.SetModeStruct(sp, smode)
+	if err != nil {
+		sp.Close() // ensure we close the port on error.
+		return nil, err
 	}
+	var port io.ReadWriteCloser = sp
+	if fd >= 0 {
+		port = &devicePort{ReadWriteCloser: sp, fd: fd}
+	}
+	return finishOpen(port, portname, mode)
+}
+
+// sersMode converts mode to a github.com/distributed/sers mode.
+func sersMode(mode Mode) (smode sers.Mode, err error) {
+	smode.Baudrate = mode.BaudRate
+	smode.DataBits = mode.DataBits
+	smode.Handshake = sers.NO_HANDSHAKE
 	switch mode.Parity {
 	case ParityNone:
-		parity = sers.N
+		smode.Parity = sers.N
 	case ParityOdd:
-		parity = sers.O
+		smode.Parity = sers.O
 	case ParityEven:
-		parity = sers.E
+		smode.Parity = sers.E
 	case ParityMark, ParitySpace:
-		return nil, errUnsupportedParity
+		return smode, errUnsupportedParity
 	default:
-		return nil, errInvalidParity
+		return smode, errInvalidParity
 	}
 	switch mode.StopBits {
 	case StopBits1:
-		stopbits = 1
+		smode.Stopbits = 1
 	case StopBits2:
-		stopbits = 2
+		smode.Stopbits = 2
 	case StopBits1Half:
-		return nil, errUnsupportedStopbits
+		return smode, errUnsupportedStopbits
 	default:
-		return nil, errInvalidStopbits
+		return smode, errInvalidStopbits
 	}
-	err = sp.SetMode(mode.BaudRate, databits, parity, stopbits, sers.NO_HANDSHAKE)
+	return smode, nil
+}
+
+// Termios implements the Opener interface by configuring the port with termios ioctls
+// directly, without depending on an external serial package. It supports read timeouts through
+// VMIN/VTIME and 1.5 stop bits on 5 bit frames, which UARTs emit when 2 stop bits are requested
+// with 5 data bits. On Linux it also supports arbitrary baud rates and mark and space parity.
+// Read timeouts are limited to 25.5s.
+//
+// With a Mode.ReadTimeout the kernel implements the timeout: a Read blocks until data arrives
+// or the timeout elapses, in which case it returns no data and [ErrReadTimeout]. This differs from
+// [NonBlocking], which polls the port from a background goroutine and implements its timeouts on
+// the buffered data, so its reads never block on the port. Closing a Termios port while a Read is
+// blocked releases the descriptor once the Read times out. Without a ReadTimeout reads wait in the
+// Go runtime poller and are interrupted by Close.
+type Termios struct {
+	// MaxReadSize, if non-zero, sets VMIN so that a read with a ReadTimeout returns once MaxReadSize
+	// bytes are received, up to 255. VTIME then becomes an inter-byte timeout: a read blocks until
+	// the first byte arrives and returns when the line is idle for ReadTimeout.
+	// It corresponds to [NonBlockingConfig.MaxReadSize] and is ignored without a ReadTimeout.
+	MaxReadSize int
+}
+
+func (Termios) String() string      { return "termios" }
+func (Termios) PackagePath() string { return "golang.org/x/sys/unix" }
+
+// Available reports whether the backend can open ports in the current build.
+// Termios is only available on Linux, excluding the ppc architectures, and Darwin.
+func (Termios) Available() bool { return termiosAvailable }
+
+func (t Termios) OpenPort(portname string, mode Mode) (io.ReadWriteCloser, error) {
+	mode, err := prepareMode(t.Capabilities(), mode)
+	if err != nil {
+		return nil, err
+	}
+	if t.MaxReadSize < 0 {
+		panic("negative Termios.MaxReadSize")
+	}
+	port, err := openTermios(portname, mode, t.MaxReadSize)
+	if err != nil {
+		return nil, openError(err)
+	}
+	return finishOpen(port, portname, mode)
+}
+
+// FromFd returns a port for the already open serial port descriptor fd, i.e. one inherited from a parent
+// process or a supervisor, configured with mode as the [Termios] Opener does. This avoids reopening the
+// device, which toggles DTR on most drivers and resets boards such as Arduinos. The returned port takes
+// ownership of fd and closes it on Close. If mode cannot be applied fd is left open, but it is closed
+// if the lock requested by [Mode.Exclusive] fails as when opening a port. The port is named "/dev/fd/N", see [PortName].
+// FromFd is available where Termios is, see [Termios.Available]. Otherwise an error wrapping [ErrNotSupported] is returned.
+func FromFd(fd uintptr, mode Mode) (io.ReadWriteCloser, error) {
+	mode, err := prepareMode(Termios{}.Capabilities(), mode)
+	if err != nil {
+		return nil, err
+	}
+	name := "/dev/fd/" + strconv.FormatUint(uint64(fd), 10)
+	port, err := termiosFromFd(int(fd), name, mode, 0)
 	if err != nil {
-		sp.Close() // ensure we close the port on error.
 		return nil, err
 	}
-	return sp, nil
+	return finishOpen(port, name, mode)
+}
+
+// prepareMode is the shared mode preparation called by all Openers before opening a port.
+// It applies the Mode defaults and checks mode is supported by an Opener with capabilities caps.
+func prepareMode(caps Capabilities, mode Mode) (Mode, error) {
+	mode, err := mode.withDefaults()
+	if err != nil {
+		return mode, err
+	}
+	return mode, caps.check(mode)
+}
+
+// finishOpen is the shared open path called by all Openers after successfully opening a port.
+// It applies the settings common to all backends. On error the port is closed.
+func finishOpen(port io.ReadWriteCloser, portname string, mode Mode) (io.ReadWriteCloser, error) {
+	if mode.Exclusive {
+		err := lockExclusive(port)
+		if err != nil {
+			port.Close()
+			return nil, err
+		}
+	}
+	if mode.NoResetOnOpen {
+		err := keepDTROnClose(port)
+		if err != nil {
+			port.Close()
+			return nil, err
+		}
+	}
+	if mode.ReadTimeout > 0 {
+		fd := -1
+		if u, err := fileDescriptor(port); err == nil {
+			fd = int(u)
+		}
+		_, nilHangup := unwrapPort(port).(goburrow.Port)
+		port = &readTimeoutPort{ReadWriteCloser: port, fd: fd, nilHangup: nilHangup}
+	}
+	if mode.WriteTimeout > 0 {
+		port = &writeTimeoutPort{
+			ReadWriteCloser: port,
+			timeout:         mode.WriteTimeout,
+			busy:            make(chan struct{}, 1),
+		}
+	}
+	if mode.MaxWriteChunk > 0 {
+		// Wraps the write timeout so that it applies to each chunk.
+		port = &chunkedWritePort{ReadWriteCloser: port, mode: mode}
+	}
+	return &namedPort{ReadWriteCloser: port, name: portname}, nil
+}
+
+// needsDevice reports whether opening a port with mode requires its descriptor. The Openers of
+// backends that don't expose their descriptor then open a companion descriptor, see devicePort.
+func needsDevice(mode Mode) bool {
+	return mode.Exclusive || mode.NoResetOnOpen
+}
+
+// openError maps the errors backends return when opening a port held exclusively by another process to
+// [ErrPortBusy]. A port locked with TIOCEXCL, as done for [Mode.Exclusive], fails to open with EBUSY
+// before the flock taken by finishOpen is reached. Other errors are returned unchanged.
+func openError(err error) error {
+	var perr *bugst.PortError
+	if errors.Is(err, syscall.EBUSY) || (errors.As(err, &perr) && perr.Code() == bugst.PortBusy) ||
+		// sers formats the error of open(2) with %v so it can't be unwrapped.
+		strings.HasSuffix(err.Error(), syscall.EBUSY.Error()) {
+		return fmt.Errorf("%w: %w", ErrPortBusy, err)
+	}
+	return err
+}
+
+// PortName returns the name passed to OpenPort when port was opened, i.e. "/dev/ttyUSB0", which is
+// useful for logging. Ports opened by the Openers in this package remember their name, also when
+// wrapped by this package's types such as [NonBlocking]. Ports implementing `PortName() string`
+// are also supported. ok is false if the name of port is not known.
+func PortName(port io.ReadWriteCloser) (name string, ok bool) {
+	for {
+		if p, ok := port.(interface{ PortName() string }); ok {
+			return p.PortName(), true
+		}
+		u, ok := port.(underlyingPort)
+		if !ok {
+			return "", false
+		}
+		port = u.Underlying()
+	}
+}
+
+// namedPort is the wrapper returned by all Openers to remember the name of the port.
+// Use [PortName] to retrieve it and the Underlying method to access the backend's port.
+type namedPort struct {
+	io.ReadWriteCloser
+	name string
+}
+
+func (np *namedPort) Underlying() io.ReadWriteCloser { return np.ReadWriteCloser }
+
+func (np *namedPort) PortName() string { return np.name }
+
+// Unwrap returns the backend's port wrapped by port, which is useful to access backend specific
+// functionality of the ports returned by the Openers in this package, i.e. by type asserting the result
+// to bugst's serial.Port. All wrappers of this package, such as [NonBlocking], are unwrapped, as are
+// other wrappers implementing `Underlying() io.ReadWriteCloser`. Ports that are not wrappers are
+// returned unchanged. The returned port should not be closed directly: close port instead so that
+// the wrappers release their resources.
+func Unwrap(port io.ReadWriteCloser) io.ReadWriteCloser {
+	return unwrapPort(port)
+}
+
+// underlyingPort is implemented by port wrappers to give access to the wrapped port.
+type underlyingPort interface {
+	Underlying() io.ReadWriteCloser
+}
+
+// unwrapPort returns the innermost port wrapped by port.
+func unwrapPort(port io.ReadWriteCloser) io.ReadWriteCloser {
+	for {
+		u, ok := port.(underlyingPort)
+		if !ok {
+			return port
+		}
+		port = u.Underlying()
+	}
+}
+
+// readTimeoutPort normalizes how backends report a read timeout to the semantics documented
+// on [Mode.ReadTimeout]. Backends return no data with either a nil error, their own timeout error
+// or an error with a Timeout method, which are replaced by ErrReadTimeout.
+//
+// Backends that read the port through an os.File with VTIME set, termios, tarm and sers outside Windows,
+// report a hang up of the other end as they do a timeout, the os.File returning io.EOF in both cases.
+// Their descriptor is polled for a hang up in that case, which is reported as io.EOF.
+// goburrow reports a hang up as a read of no data with a nil error and bugst with an error of its own.
+type readTimeoutPort struct {
+	io.ReadWriteCloser
+	// fd is the descriptor of the port, or -1 if it has none.
+	fd int
+	// nilHangup is set if the backend reports a hang up as a read of no data with a nil error.
+	nilHangup bool
+}
+
+func (rp *readTimeoutPort) Underlying() io.ReadWriteCloser { return rp.ReadWriteCloser }
+
+func (rp *readTimeoutPort) Read(b []byte) (int, error) {
+	n, err := rp.ReadWriteCloser.Read(b)
+	switch {
+	case len(b) == 0:
+		return n, err
+	case n == 0 && err == nil && rp.nilHangup:
+		return 0, io.EOF
+	case !rp.isTimeout(err):
+		return n, err
+	case n > 0:
+		return n, nil // Data received before the timeout.
+	case rp.fd >= 0 && hungUp(uintptr(rp.fd)):
+		return 0, io.EOF
+	}
+	return 0, ErrReadTimeout
+}
+
+// isTimeout reports whether err is returned by a backend's read that timed out.
+// A nil error is only a timeout when the read returned no data. io.EOF is only
+// a timeout for ports whose descriptor tells it apart from a hang up.
+func (rp *readTimeoutPort) isTimeout(err error) bool {
+	var te interface{ Timeout() bool }
+	return err == nil || (rp.fd >= 0 && err == io.EOF) || err == goburrow.ErrTimeout ||
+		errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &te) && te.Timeout())
+}
+
+// writeTimeoutPort implements a write timeout for ports whose Write blocks indefinitely.
+type writeTimeoutPort struct {
+	io.ReadWriteCloser
+	timeout time.Duration
+	// busy is held while a write to the underlying port is in progress.
+	busy chan struct{}
+	mu   sync.Mutex
+	// lateErr is the first error returned by a write that completed after timing out.
+	lateErr error
+}
+
+func (wp *writeTimeoutPort) Underlying() io.ReadWriteCloser { return wp.ReadWriteCloser }
+
+// Write writes b to the underlying port. If the write does not complete within
+// the timeout ErrWriteTimeout is returned. The timed out write continues in the background
+// so its data may still be written at a later time; following writes wait for it to complete.
+// If the timed out write fails its error is returned by Close.
+func (wp *writeTimeoutPort) Write(b []byte) (int, error) {
+	timer := time.NewTimer(wp.timeout)
+	defer timer.Stop()
+	select {
+	case wp.busy <- struct{}{}:
+	case <-timer.C:
+		return 0, ErrWriteTimeout // Previous write still in progress.
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	abandon := make(chan struct{})
+	// Copy data since the caller may reuse b if we time out.
+	data := append([]byte(nil), b...)
+	go func() {
+		n, err := wp.ReadWriteCloser.Write(data)
+		<-wp.busy
+		select {
+		case done <- result{n: n, err: err}:
+		case <-abandon:
+			wp.mu.Lock()
+			defer wp.mu.Unlock()
+			if wp.lateErr == nil {
+				wp.lateErr = err
+			}
+		}
+	}()
+	select {
+	case res := <-done:
+		return res.n, res.err
+	case <-timer.C:
+		close(abandon)
+		return 0, ErrWriteTimeout
+	}
+}
+
+// Close closes the underlying port. The error of a timed out write that failed in the background,
+// which would otherwise be lost, is joined with the error returned by the underlying port.
+func (wp *writeTimeoutPort) Close() error {
+	err := wp.ReadWriteCloser.Close()
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return errors.Join(wp.lateErr, err)
+}
+
+// chunkedWritePort splits writes into chunks of at most mode.MaxWriteChunk bytes
+// separated by the time it takes to transmit them plus mode.InterChunkDelay.
+type chunkedWritePort struct {
+	io.ReadWriteCloser
+	mode Mode
+	// mu keeps the chunks of concurrent writes from interleaving.
+	mu sync.Mutex
+}
+
+func (cp *chunkedWritePort) Underlying() io.ReadWriteCloser { return cp.ReadWriteCloser }
+
+func (cp *chunkedWritePort) Write(b []byte) (n int, err error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > cp.mode.MaxWriteChunk {
+			chunk = chunk[:cp.mode.MaxWriteChunk]
+		}
+		nw, err := cp.ReadWriteCloser.Write(chunk)
+		n += nw
+		if err != nil {
+			return n, err
+		} else if nw < len(chunk) {
+			return n, io.ErrShortWrite
+		}
+		b = b[nw:]
+		if len(b) > 0 {
+			time.Sleep(cp.mode.TransmitDuration(nw) + cp.mode.InterChunkDelay)
+		}
+	}
+	return n, nil
 }
 
 // ResetInputBuffer discards data received but not read by the port. It expects a port type
@@ -231,6 +1013,8 @@ func ResetInputBuffer(port io.Reader) error {
 	case *NonBlocking:
 		r.Reset()
 		return nil
+	case underlyingPort:
+		return ResetInputBuffer(r.Underlying())
 	}
 	type resetter interface {
 		Reset()
@@ -251,3 +1035,161 @@ func ResetInputBuffer(port io.Reader) error {
 	}
 	return errors.New("cereal: ResetInputBuffer not implemented by argument")
 }
+
+// FlushAll discards both data received but not read and data written but not yet transmitted by the port,
+// leaving a clean slate, i.e. after a protocol error. The read buffers of [NonBlocking] ports wrapping port
+// are also discarded. Ports with a file descriptor (see [FileDescriptor]) are flushed by the OS using it,
+// which covers Termios and sers ports on Linux. Otherwise tarm ports are flushed with their own method and
+// ports implementing both `ResetInputBuffer() error` and `ResetOutputBuffer() error`, such as bugst ports,
+// have them called. If the port cannot be flushed an error wrapping [ErrNotSupported] is returned.
+func FlushAll(port io.ReadWriteCloser) error {
+	fd, err := fileDescriptor(port)
+	if err == nil {
+		err = flushTerminal(fd)
+	} else {
+		err = flushPort(port)
+	}
+	resetNonBlocking(port) // Reset after flushing so no data read in between remains.
+	return err
+}
+
+// flushPort flushes port, which has no file descriptor, with the methods of its outermost layer that has them.
+func flushPort(port io.ReadWriteCloser) error {
+	type resetter interface {
+		ResetInputBuffer() error
+		ResetOutputBuffer() error
+	}
+	switch p := port.(type) {
+	case *tarm.Port:
+		return p.Flush()
+	case resetter:
+		return errors.Join(p.ResetInputBuffer(), p.ResetOutputBuffer())
+	case underlyingPort:
+		return flushPort(p.Underlying())
+	}
+	return errNoFileDescriptor
+}
+
+// WaitDrain blocks until all data written to port has been transmitted or the deadline passes, in which case
+// a timeout error satisfying errors.Is(err, os.ErrDeadlineExceeded) is returned. Unlike sleeping for
+// [Mode.TransmitDuration] it accounts for data queued by earlier writes and for flow control stalls.
+//
+// If port implements `Drain() error`, as bugst ports do, it is called. Otherwise the OS drains the port
+// using its file descriptor, which is only supported on Linux. An error wrapping [ErrNotSupported] is
+// returned on other platforms. Neither can be interrupted, so the drain is run in a separate goroutine
+// that is abandoned when the deadline passes and lives until the drain completes.
+func WaitDrain(port io.ReadWriteCloser, deadline time.Time) error {
+	var drain func() error
+	if p, ok := unwrapPort(port).(interface{ Drain() error }); ok {
+		drain = p.Drain
+	} else {
+		fd, err := fileDescriptor(port)
+		if err != nil {
+			return err
+		}
+		drain = func() error { return drainTerminal(fd) }
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	done := make(chan error, 1)
+	go func() { done <- drain() }()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errDeadlineExceeded
+	}
+}
+
+// SetReadBufferSize sets the size in bytes of the OS driver's receive buffer for the port. A larger buffer
+// reduces overruns when data is not read fast enough at high baud rates. As a rule of thumb the buffer
+// should hold at least 50ms of traffic: 8KiB at 1Mbps and 16KiB to 32KiB at 3Mbps, with 64KiB
+// giving ample margin on loaded systems. The driver treats the size as a recommendation and may ignore it.
+//
+// If port implements `SetReadBufferSize(int) error` it is called. Otherwise the buffer is set using
+// the port's handle, see [FileDescriptor], which is only supported on Windows where the transmit buffer is set
+// to the same size. None of the backends of the Openers in this package expose their handle on Windows, so
+// their ports return an error wrapping [ErrNotSupported]: only ports implementing `Fd() uintptr`, such as an
+// *os.File of a COM port opened by the caller, are supported. POSIX terminals have no such interface so an
+// error wrapping [ErrNotSupported] is returned on other platforms.
+func SetReadBufferSize(port io.ReadWriteCloser, size int) error {
+	if size <= 0 {
+		panic("invalid read buffer size")
+	}
+	if p, ok := unwrapPort(port).(interface{ SetReadBufferSize(int) error }); ok {
+		return p.SetReadBufferSize(size)
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	return setReadBufferSize(fd, size)
+}
+
+// PortErrors returns the amount of framing, parity and overrun errors detected by the driver for the port.
+// The counters are cumulative and kept by the OS, so they may include errors that happened
+// before the port was opened; compare successive calls to detect new errors.
+// Parity and framing errors usually point to a baud rate or frame format mismatch while
+// overruns indicate data is not being read fast enough.
+//
+// If port implements `PortErrors() (framing, parity, overrun uint64, err error)` it is called.
+// Otherwise the counters are read from the OS using the port's file descriptor, which is
+// only supported on Linux. [ErrNotSupported] is returned on other platforms.
+func PortErrors(port io.ReadWriteCloser) (framing, parity, overrun uint64, err error) {
+	type portErrorer interface {
+		PortErrors() (framing, parity, overrun uint64, err error)
+	}
+	if pe, ok := unwrapPort(port).(portErrorer); ok {
+		return pe.PortErrors()
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return portErrors(fd)
+}
+
+// SetLowLatency enables or disables the low latency mode of the serial driver. USB adapters such as
+// FTDI's buffer received data for up to 16ms by default before passing it on, which limits request/response
+// protocols to a few dozen round trips per second; low latency mode reduces the delay to about 1ms
+// at the cost of more CPU wakeups. See [SetLatencyTimer] for finer control.
+//
+// If port implements `SetLowLatency(bool) error` it is called. Otherwise the driver's ASYNC_LOW_LATENCY
+// flag is set using the port's file descriptor, which is only supported on Linux. An error wrapping
+// [ErrNotSupported] is returned on other platforms and by drivers without the flag.
+func SetLowLatency(port io.ReadWriteCloser, enable bool) error {
+	if p, ok := unwrapPort(port).(interface{ SetLowLatency(bool) error }); ok {
+		return p.SetLowLatency(enable)
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	return setLowLatency(fd, enable)
+}
+
+// SetLatencyTimer sets the latency timer of FTDI-style USB serial adapters: the time the adapter
+// waits to fill a USB packet before sending received data to the host. Short timers reduce the latency
+// of request/response protocols while long timers increase throughput and reduce CPU wakeups.
+// d is rounded up to a whole millisecond and must be between 1ms and 255ms.
+//
+// If port implements `SetLatencyTimer(time.Duration) error` it is called. Otherwise the timer is set
+// through sysfs using the port's file descriptor, which is only supported on Linux and usually requires
+// write permission on the sysfs attribute. An error wrapping [ErrNotSupported] is returned
+// on other platforms and for adapters without a latency timer.
+func SetLatencyTimer(port io.ReadWriteCloser, d time.Duration) error {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 || ms > 255 {
+		return errInvalidLatencyTimer
+	}
+	if p, ok := unwrapPort(port).(interface{ SetLatencyTimer(time.Duration) error }); ok {
+		return p.SetLatencyTimer(d)
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	return setLatencyTimer(fd, int(ms))
+}
+
+var errInvalidLatencyTimer = errors.New("latency timer must be between 1ms and 255ms")
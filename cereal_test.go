@@ -1,11 +1,25 @@
 package cereal_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -13,13 +27,17 @@ import (
 )
 
 func ExampleOpener() {
-	availableLibs := map[string]cereal.Opener{
-		cereal.Bugst{}.String():    cereal.Bugst{},
-		cereal.Tarm{}.String():     cereal.Tarm{},
-		cereal.Goburrow{}.String(): cereal.Goburrow{},
-		cereal.Sers{}.String():     cereal.Sers{},
+	availableLibs := make(map[string]cereal.Opener)
+	for _, lib := range []interface {
+		cereal.Opener
+		String() string
+		Available() bool
+	}{cereal.Bugst{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Termios{}} {
+		if lib.Available() {
+			availableLibs[lib.String()] = lib // Skip sers without cgo and termios off linux.
+		}
 	}
-	flagSerial := flag.String("seriallib", "bugst", "Serial library to use: bugst, tarm, goburrow, sers")
+	flagSerial := flag.String("seriallib", "bugst", "Serial library to use: bugst, tarm, goburrow, sers, termios")
 	flag.Parse()
 	serial, ok := availableLibs[*flagSerial]
 	if !ok {
@@ -64,6 +82,347 @@ func ExampleForEachPort() {
 	}
 }
 
+func TestForEachPortContext(t *testing.T) {
+	var want, got []string
+	wantErr := cereal.ForEachPort(func(port cereal.PortDetails) (bool, error) {
+		want = append(want, port.Name)
+		return false, nil
+	})
+	gotErr := cereal.ForEachPortContext(context.Background(), func(port cereal.PortDetails) (bool, error) {
+		got = append(got, port.Name)
+		return false, nil
+	})
+	if (wantErr == nil) != (gotErr == nil) || strings.Join(want, ",") != strings.Join(got, ",") {
+		t.Errorf("expected same result as ForEachPort: %v, %v; got %v, %v", want, wantErr, got, gotErr)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := cereal.ForEachPortContext(ctx, func(port cereal.PortDetails) (bool, error) {
+		t.Error("fn called after cancellation")
+		return true, nil
+	})
+	if err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+func TestFindPort(t *testing.T) {
+	_, found, err := cereal.FindPort(func(cereal.PortDetails) bool { return false })
+	if err != nil {
+		t.Skip("enumeration failed:", err)
+	} else if found {
+		t.Fatal("expected no port found")
+	}
+	calls := 0
+	first, found, err := cereal.FindPort(func(cereal.PortDetails) bool {
+		calls++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found && (calls != 1 || first.Name == "") {
+		t.Errorf("expected enumeration to stop at first match, got %d calls and %+v", calls, first)
+	}
+}
+
+func TestOpenAllMatching(t *testing.T) {
+	var names []string
+	err := cereal.ForEachPort(func(port cereal.PortDetails) (bool, error) {
+		names = append(names, port.Name)
+		return false, nil
+	})
+	if err != nil {
+		t.Skip("enumeration failed:", err)
+	}
+	open := 0
+	opener := openerFunc(func(portname string, mode cereal.Mode) (io.ReadWriteCloser, error) {
+		open++
+		return &readwritecloser{close: func() error { open--; return nil }}, nil
+	})
+	all := func(cereal.PortDetails) bool { return true }
+	ports, err := cereal.OpenAllMatching(opener, all, cereal.Mode{BaudRate: 9600})
+	if err != nil || len(ports) != len(names) || open != len(names) {
+		t.Fatalf("expected %d ports opened, got %d (%d open), %v", len(names), len(ports), open, err)
+	}
+	for _, port := range ports {
+		port.Close()
+	}
+	ports, err = cereal.OpenAllMatching(opener, cereal.MatchUSB(0, 0), cereal.Mode{BaudRate: 9600})
+	if err != nil || len(ports) != 0 {
+		t.Fatalf("expected no ports for reserved VID 0, got %v, %v", ports, err)
+	}
+	if len(names) == 0 {
+		t.Skip("no ports to test partial failure")
+	}
+	failing := names[len(names)-1]
+	opener = openerFunc(func(portname string, mode cereal.Mode) (io.ReadWriteCloser, error) {
+		if portname == failing {
+			return nil, errors.New("open failed")
+		}
+		open++
+		return &readwritecloser{close: func() error { open--; return nil }}, nil
+	})
+	ports, err = cereal.OpenAllMatching(opener, all, cereal.Mode{BaudRate: 9600})
+	if err == nil || ports != nil || open != 0 || !strings.Contains(err.Error(), failing) {
+		t.Fatalf("expected all ports closed and error naming %s, got %v (%d open), %v", failing, ports, open, err)
+	}
+}
+
+func TestFindUSBInterface(t *testing.T) {
+	// No device has the reserved VID 0.
+	_, err := cereal.FindUSBInterface(0, 0, 0)
+	if !errors.Is(err, cereal.ErrPortNotFound) {
+		t.Skip("enumeration failed:", err)
+	}
+	err = cereal.ForEachPort(func(port cereal.PortDetails) (bool, error) {
+		if !port.IsUSB && port.Interface != -1 {
+			t.Errorf("%s: expected no interface number for non-USB port, got %d", port.Name, port.Interface)
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenPortContext(t *testing.T) {
+	t.Parallel()
+	unblock := make(chan struct{})
+	closed := make(chan struct{})
+	o := openerFunc(func(string, cereal.Mode) (io.ReadWriteCloser, error) {
+		<-unblock
+		return &readwritecloser{close: func() error {
+			close(closed)
+			return nil
+		}}, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	port, err := cereal.OpenPortContext(ctx, o, "/dev/ttyUSB0", cereal.Mode{})
+	if port != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded error", port, err)
+	}
+	close(unblock)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned port was not closed")
+	}
+}
+
+func TestPortErrorsUnsupported(t *testing.T) {
+	_, _, _, err := cereal.PortErrors(&readwritecloser{})
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Fatal("expected ErrNotSupported, got", err)
+	}
+	framing, parity, overrun, err := cereal.PortErrors(&portErrorer{framing: 1, parity: 2, overrun: 3})
+	if err != nil || framing != 1 || parity != 2 || overrun != 3 {
+		t.Fatal("unexpected port errors", framing, parity, overrun, err)
+	}
+}
+
+func TestPortErrorsWrapped(t *testing.T) {
+	o := noTimeoutOpener{openerFunc(func(string, cereal.Mode) (io.ReadWriteCloser, error) {
+		pe := &portErrorer{framing: 1, parity: 2, overrun: 3}
+		pe.read = func([]byte) (int, error) { return 0, io.EOF }
+		return pe, nil
+	})}
+	port, err := cereal.OpenWithTimeout(o, "errs", cereal.Mode{BaudRate: 9600, ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	framing, parity, overrun, err := cereal.PortErrors(port)
+	if err != nil || framing != 1 || parity != 2 || overrun != 3 {
+		t.Fatal("unexpected port errors of wrapped port", framing, parity, overrun, err)
+	}
+}
+
+func TestFileDescriptor(t *testing.T) {
+	_, err := cereal.FileDescriptor(&readwritecloser{})
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Fatal("expected ErrNotSupported, got", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	nb := cereal.NewNonBlocking(w, cereal.NonBlockingConfig{LazyStart: true})
+	fd, err := cereal.FileDescriptor(nb)
+	if err != nil || fd != w.Fd() {
+		t.Fatalf("expected fd %d of wrapped file, got %d, %v", w.Fd(), fd, err)
+	}
+}
+
+func TestPortName(t *testing.T) {
+	if name, ok := cereal.PortName(&readwritecloser{}); ok {
+		t.Errorf("expected unknown port name, got %q", name)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	err := cereal.FlushAll(&readwritecloser{})
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Fatal("expected ErrNotSupported, got", err)
+	}
+	port := &flushPort{}
+	sent := false
+	port.read = func(b []byte) (int, error) {
+		if sent {
+			time.Sleep(time.Millisecond)
+			return 0, nil
+		}
+		sent = true
+		return copy(b, "stale"), nil
+	}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	for nb.Buffered() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+	err = cereal.FlushAll(nb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port.in != 1 || port.out != 1 {
+		t.Errorf("expected input and output flushed once, got %d and %d", port.in, port.out)
+	}
+	if nb.Buffered() != 0 {
+		t.Error("expected NonBlocking buffer flushed")
+	}
+}
+
+type flushPort struct {
+	readwritecloser
+	in, out int
+}
+
+func (fp *flushPort) ResetInputBuffer() error  { fp.in++; return nil }
+func (fp *flushPort) ResetOutputBuffer() error { fp.out++; return nil }
+
+func TestWaitDrain(t *testing.T) {
+	err := cereal.WaitDrain(&readwritecloser{}, time.Now().Add(time.Second))
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Fatal("expected ErrNotSupported, got", err)
+	}
+	drained := make(chan struct{})
+	port := &drainPort{drained: drained}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+	err = cereal.WaitDrain(nb, time.Now().Add(20*time.Millisecond))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("expected timeout while output is pending, got", err)
+	}
+	close(drained)
+	err = cereal.WaitDrain(nb, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type drainPort struct {
+	readwritecloser
+	drained chan struct{}
+}
+
+func (dp *drainPort) Drain() error {
+	<-dp.drained
+	return nil
+}
+
+func TestSetReadBufferSize(t *testing.T) {
+	err := cereal.SetReadBufferSize(&readwritecloser{}, 4096)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+	port := &bufferSizePort{}
+	err = cereal.SetReadBufferSize(cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true}), 65536)
+	if err != nil || port.size != 65536 {
+		t.Errorf("expected port method called with 65536, got %d, %v", port.size, err)
+	}
+	// Ports exposing their handle reach the driver on Windows, which rejects a handle that is not a serial port.
+	f, err := os.CreateTemp(t.TempDir(), "port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = cereal.SetReadBufferSize(cereal.NewNonBlocking(f, cereal.NonBlockingConfig{LazyStart: true}), 65536)
+	if runtime.GOOS != "windows" && !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported outside Windows, got", err)
+	} else if runtime.GOOS == "windows" && (err == nil || errors.Is(err, cereal.ErrNotSupported)) {
+		t.Error("expected driver to reject handle of regular file, got", err)
+	}
+}
+
+type bufferSizePort struct {
+	readwritecloser
+	size int
+}
+
+func (bp *bufferSizePort) SetReadBufferSize(size int) error { bp.size = size; return nil }
+
+func TestSetLowLatency(t *testing.T) {
+	err := cereal.SetLowLatency(&readwritecloser{}, true)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+	port := &lowLatencyPort{}
+	err = cereal.SetLowLatency(cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true}), true)
+	if err != nil || !port.enabled {
+		t.Errorf("expected port method called, got %v, %v", port.enabled, err)
+	}
+	if (cereal.Termios{}).Available() {
+		// Pseudoterminals are not serial drivers and have no low latency flag.
+		pty, err := cereal.Termios{}.OpenPort("/dev/ptmx", cereal.Mode{BaudRate: 9600})
+		if err != nil {
+			t.Skip(err)
+		}
+		defer pty.Close()
+		err = cereal.SetLowLatency(pty, true)
+		if !errors.Is(err, cereal.ErrNotSupported) {
+			t.Error("expected ErrNotSupported for pseudoterminal, got", err)
+		}
+	}
+}
+
+func TestSetLatencyTimer(t *testing.T) {
+	port := &lowLatencyPort{}
+	for _, d := range []time.Duration{0, 256 * time.Millisecond, time.Second} {
+		if err := cereal.SetLatencyTimer(port, d); err == nil {
+			t.Errorf("expected error for latency timer %s", d)
+		}
+	}
+	err := cereal.SetLatencyTimer(port, 2*time.Millisecond)
+	if err != nil || port.latency != 2*time.Millisecond {
+		t.Errorf("expected port method called with 2ms, got %s, %v", port.latency, err)
+	}
+	err = cereal.SetLatencyTimer(&readwritecloser{}, time.Millisecond)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+	if (cereal.Termios{}).Available() {
+		pty, err := cereal.Termios{}.OpenPort("/dev/ptmx", cereal.Mode{BaudRate: 9600})
+		if err != nil {
+			t.Skip(err)
+		}
+		defer pty.Close()
+		err = cereal.SetLatencyTimer(pty, time.Millisecond)
+		if !errors.Is(err, cereal.ErrNotSupported) {
+			t.Error("expected ErrNotSupported for pseudoterminal, got", err)
+		}
+	}
+}
+
+type lowLatencyPort struct {
+	readwritecloser
+	enabled bool
+	latency time.Duration
+}
+
+func (lp *lowLatencyPort) SetLowLatency(enable bool) error       { lp.enabled = enable; return nil }
+func (lp *lowLatencyPort) SetLatencyTimer(d time.Duration) error { lp.latency = d; return nil }
+
 func TestNonBlockingRead(t *testing.T) {
 	t.Parallel()
 	var data [1024]byte
@@ -105,71 +464,2545 @@ func TestNonBlockingRead(t *testing.T) {
 	}
 }
 
-func TestNonBlockingBlocked(t *testing.T) {
-	t.Parallel()
-	const (
-		block   = 100 * time.Millisecond
-		timeout = 5 * time.Millisecond
-		data    = "hello partner!"
-	)
-	rwc := &readwritecloser{
-		read: func(b []byte) (int, error) {
-			time.Sleep(block)
-			return copy(b, data), nil
+func TestNonBlockingDrainBeforeEOF(t *testing.T) {
+	data := []byte("pending data left in the buffer after the source closed")
+	for _, timeout := range []time.Duration{0, 10 * time.Millisecond} {
+		src := bytes.NewReader(data)
+		nb := cereal.NewNonBlocking(&readwritecloser{read: src.Read}, cereal.NonBlockingConfig{
+			ReadTimeout: timeout,
+		})
+		for nb.Buffered() != len(data) {
+			time.Sleep(time.Millisecond)
+		}
+		nb.Close()
+		var got []byte
+		var buf [7]byte
+		for {
+			n, err := nb.Read(buf[:])
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			} else if n == 0 {
+				t.Fatal("empty read with data pending")
+			}
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("timeout %s: expected %q; got %q", timeout, data, got)
+		}
+	}
+}
+
+func TestNonBlockingReadAtLeast(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	var buf [8]byte
+	_, err := nb.ReadAtLeast(buf[:2], 3, time.Now().Add(time.Second))
+	if err != io.ErrShortBuffer {
+		t.Error("expected io.ErrShortBuffer, got", err)
+	}
+	port.Write([]byte("abc"))
+	n, err := nb.ReadAtLeast(buf[:], 5, time.Now().Add(50*time.Millisecond))
+	if err == nil || n != 3 || string(buf[:n]) != "abc" {
+		t.Errorf("expected partial read with timeout error, got %q, %v", buf[:n], err)
+	}
+	port.Write([]byte("defgh"))
+	n, err = nb.ReadAtLeast(buf[:], 5, time.Now().Add(time.Second))
+	if err != nil || string(buf[:n]) != "defgh" {
+		t.Errorf("expected %q, got %q, %v", "defgh", buf[:n], err)
+	}
+}
+
+func TestReadFullDeadline(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	go func() {
+		port.Write([]byte("ab"))
+		time.Sleep(20 * time.Millisecond)
+		port.Write([]byte("cd"))
+	}()
+	buf := make([]byte, 4)
+	n, err := cereal.ReadFullDeadline(nb, buf, time.Now().Add(time.Second))
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Fatalf("expected to read across chunks, got %q, %v", buf[:n], err)
+	}
+	port.Write([]byte("ef"))
+	n, err = cereal.ReadFullDeadline(nb, buf, time.Now().Add(50*time.Millisecond))
+	if !errors.Is(err, os.ErrDeadlineExceeded) || string(buf[:n]) != "ef" {
+		t.Fatalf("expected partial read with timeout, got %q, %v", buf[:n], err)
+	}
+}
+
+func TestNonBlockingAppendRead(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	port.Write([]byte("abc"))
+	if err := nb.WaitFor(3, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, 0, 8)
+	dst, err := nb.AppendRead(append(dst, '>'), time.Now().Add(time.Second))
+	if err != nil || string(dst) != ">abc" {
+		t.Fatalf("expected appended data, got %q, %v", dst, err)
+	}
+	dst, err = nb.AppendRead(dst, time.Now().Add(20*time.Millisecond))
+	if !errors.Is(err, os.ErrDeadlineExceeded) || string(dst) != ">abc" {
+		t.Fatalf("expected timeout with dst unmodified, got %q, %v", dst, err)
+	}
+	port.Write([]byte("defghijk"))
+	if err := nb.WaitFor(8, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	dst, err = nb.AppendRead(dst, time.Now().Add(time.Second))
+	if err != nil || string(dst) != ">abcdefghijk" {
+		t.Fatalf("expected dst to grow, got %q, %v", dst, err)
+	}
+}
+
+func TestNonBlockingReadTimed(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	const timeout = 50 * time.Millisecond
+	buf := make([]byte, 3)
+	n, waited, err := nb.ReadTimed(buf, time.Now().Add(timeout))
+	if n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) || waited < timeout {
+		t.Fatalf("expected timeout after waiting %s, got %d, %v after %s", timeout, n, err, waited)
+	}
+	const delay = 20 * time.Millisecond
+	time.AfterFunc(delay, func() { port.Write([]byte("abc")) })
+	n, waited, err = nb.ReadTimed(buf, time.Now().Add(time.Second))
+	if err != nil || string(buf[:n]) != "abc" {
+		t.Fatalf("expected to read data, got %q, %v", buf[:n], err)
+	}
+	if waited < delay || waited >= time.Second {
+		t.Errorf("expected to wait for the data to arrive after %s, waited %s", delay, waited)
+	}
+}
+
+func TestNonBlockingSnapshot(t *testing.T) {
+	// The anonymous struct hides the Bytes method of bytes.Buffer.
+	for _, buf := range []cereal.Buffer{nil, &bytes.Buffer{}, struct{ cereal.Buffer }{&bytes.Buffer{}}} {
+		port := newLoopback()
+		nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{Buffer: buf})
+		port.Write([]byte("abc"))
+		if err := nb.WaitFor(3, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if got := nb.Snapshot(); string(got) != "abc" {
+			t.Errorf("%T: expected snapshot %q, got %q", buf, "abc", got)
+		}
+		got := make([]byte, 3)
+		n, err := nb.Read(got)
+		if err != nil || string(got[:n]) != "abc" {
+			t.Errorf("%T: expected snapshot not to consume data, got %q, %v", buf, got[:n], err)
+		}
+		nb.Close()
+	}
+}
+
+func TestNonBlockingUnread(t *testing.T) {
+	for _, buf := range []cereal.Buffer{nil, &bytes.Buffer{}} {
+		port := newLoopback()
+		nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{MaxReadBuffered: 8, Buffer: buf})
+		port.Write([]byte("abcdef"))
+		if err := nb.WaitFor(6, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 4)
+		nb.Read(got)
+		if err := nb.Unread(got[2:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := nb.Unread([]byte("uvwxy")); err != io.ErrShortBuffer {
+			t.Errorf("%T: expected io.ErrShortBuffer putting back more than the free space, got %v", buf, err)
+		}
+		if err := nb.Unread([]byte("xy")); err != nil {
+			t.Fatal(err)
+		}
+		got = make([]byte, 6)
+		n, err := nb.ReadDeadline(got, time.Now().Add(time.Second))
+		if err != nil || string(got[:n]) != "xycdef" {
+			t.Errorf("%T: expected put back bytes first, got %q, %v", buf, got[:n], err)
+		}
+		nb.Close()
+	}
+}
+
+func TestNonBlockingUnreadDuringRead(t *testing.T) {
+	reading := make(chan struct{}, 1)
+	data := make(chan []byte)
+	port := &readwritecloser{read: func(b []byte) (int, error) {
+		reading <- struct{}{}
+		d, ok := <-data
+		if !ok {
+			return 0, io.EOF
+		}
+		return copy(b, d), nil
+	}}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{MaxReadBuffered: 8})
+	defer nb.Close()
+	<-reading
+	// The read in progress may fill the buffer so there is no room to put bytes back.
+	if err := nb.Unread([]byte("x")); err != io.ErrShortBuffer {
+		t.Error("expected io.ErrShortBuffer putting back bytes during a read, got", err)
+	}
+	data <- []byte("abcdefgh")
+	got := make([]byte, 8)
+	n, err := nb.ReadDeadline(got, time.Now().Add(time.Second))
+	if err != nil || string(got[:n]) != "abcdefgh" {
+		t.Errorf("expected all bytes of the read, got %q, %v", got[:n], err)
+	}
+	close(data)
+}
+
+func TestNonBlockingWaitFor(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{MaxReadBuffered: 16})
+	if err := nb.WaitFor(17, time.Now().Add(time.Second)); err != io.ErrShortBuffer {
+		t.Error("expected io.ErrShortBuffer, got", err)
+	}
+	port.Write([]byte("abc"))
+	err := nb.WaitFor(5, time.Now().Add(50*time.Millisecond))
+	if err == nil || nb.Buffered() != 3 {
+		t.Fatalf("expected timeout without consuming data, got %v with %d buffered", err, nb.Buffered())
+	}
+	port.Write([]byte("de"))
+	err = nb.WaitFor(5, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [5]byte
+	n, err := nb.Read(buf[:])
+	if err != nil || string(buf[:n]) != "abcde" {
+		t.Errorf("expected whole frame in a single read, got %q, %v", buf[:n], err)
+	}
+}
+
+func TestNonBlockingIdle(t *testing.T) {
+	a, b := cereal.Pipe()
+	defer b.Close()
+	const interval = 50 * time.Millisecond
+	var keepalives atomic.Int32
+	nb := cereal.NewNonBlocking(a, cereal.NonBlockingConfig{
+		IdleInterval: interval,
+		IdleFunc: func() []byte {
+			keepalives.Add(1)
+			return []byte{0}
 		},
+	})
+	defer nb.Close()
+	device := cereal.NewNonBlocking(b, cereal.NonBlockingConfig{})
+	var buf [8]byte
+	n, err := device.ReadDeadline(buf[:1], time.Now().Add(10*interval))
+	if err != nil || n != 1 || buf[0] != 0 {
+		t.Fatalf("expected keep-alive byte, got %q, %v", buf[:n], err)
+	}
+	// Data received keeps the link alive, so no keep-alive is written while the device talks.
+	b.Write([]byte("x"))
+	time.Sleep(interval / 5)
+	sent := keepalives.Load()
+	stop := time.Now().Add(4 * interval)
+	for time.Now().Before(stop) {
+		b.Write([]byte("x"))
+		time.Sleep(interval / 5)
+	}
+	if got := keepalives.Load(); got != sent {
+		t.Errorf("expected no keep-alive while receiving data, got %d", got-sent)
+	}
+	// Caller writes are never interleaved with keep-alives.
+	device.Reset()
+	msg := bytes.Repeat([]byte("m"), 64)
+	nb.Write(msg)
+	time.Sleep(2 * interval)
+	got := make([]byte, 256)
+	n, _ = device.ReadDeadline(got, time.Now().Add(interval))
+	if !bytes.Contains(got[:n], msg) {
+		t.Errorf("expected message written whole, got %q", got[:n])
 	}
+}
 
-	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
-		ReadTimeout: timeout,
+func TestNonBlockingDone(t *testing.T) {
+	waitDone := func(name string, nb *cereal.NonBlocking) {
+		t.Helper()
+		select {
+		case <-nb.Done():
+		case <-time.After(time.Second):
+			t.Errorf("%s: Done not closed", name)
+		}
+	}
+	a, b := cereal.Pipe()
+	nb := cereal.NewNonBlocking(a, cereal.NonBlockingConfig{})
+	select {
+	case <-nb.Done():
+		t.Fatal("Done closed while reader running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.Close()
+	waitDone("EOF", nb)
+
+	nb = cereal.NewNonBlocking(&readwritecloser{}, cereal.NonBlockingConfig{
+		ReadFunc: func([]byte) (int, error) { panic("read") },
 	})
-	// This call should fail with deadline exceeded.
-	buf := make([]byte, len(data))
-	n, err := nb.Read(buf)
-	if n != 0 || err == nil {
-		t.Fatal("unexpected NonBlocking behaviour", n, err)
+	waitDone("panic", nb)
+
+	nb = cereal.NewNonBlocking(&readwritecloser{}, cereal.NonBlockingConfig{LazyStart: true})
+	nb.Close()
+	waitDone("lazy close", nb)
+}
+
+func TestNonBlockingReadIdle(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	var buf [16]byte
+	const idle = 50 * time.Millisecond
+	start := time.Now()
+	n, err := nb.ReadIdle(buf[:], idle, time.Second)
+	if err == nil || n != 0 {
+		t.Fatalf("expected timeout error on idle bus, got %d, %v", n, err)
+	} else if elapsed := time.Since(start); elapsed > 10*idle {
+		t.Errorf("expected return after idle period, took %s", elapsed)
 	}
-	time.Sleep(block - timeout)
-	n, err = nb.Read(buf)
-	if n != len(buf) || err != nil {
-		t.Fatal("expected to read blocked data", n, err)
+	go func() {
+		for _, c := range []byte("abcd") {
+			port.Write([]byte{c})
+			time.Sleep(idle / 5)
+		}
+	}()
+	n, err = nb.ReadIdle(buf[:], idle, time.Second)
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Errorf("expected %q read until idle, got %q, %v", "abcd", buf[:n], err)
+	}
+	// The timeout caps the read even if the bus never goes idle.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(idle / 5):
+				port.Write([]byte{'x'})
+			}
+		}
+	}()
+	start = time.Now()
+	n, err = nb.ReadIdle(make([]byte, 1024), idle, 4*idle)
+	if elapsed := time.Since(start); err != nil || n == 0 || elapsed > 8*idle {
+		t.Errorf("expected data before timeout, got %d, %v after %s", n, err, elapsed)
 	}
+}
 
-	if string(buf) != data {
-		t.Errorf("expected %q; got %q", data, buf)
+func TestNonBlockingReadInterByte(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	var buf [16]byte
+	const interByte = 50 * time.Millisecond
+	// The response starts later than the inter-byte timeout but within the overall timeout.
+	go func() {
+		time.Sleep(3 * interByte)
+		for _, c := range []byte("abcd") {
+			port.Write([]byte{c})
+			time.Sleep(interByte / 5)
+		}
+		time.Sleep(3 * interByte)
+		port.Write([]byte("next"))
+	}()
+	n, err := nb.ReadInterByte(buf[:], interByte, time.Second)
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Errorf("expected %q framed by inter-byte timeout, got %q, %v", "abcd", buf[:n], err)
+	}
+	n, err = nb.ReadInterByte(buf[:], interByte, time.Second)
+	if err != nil || string(buf[:n]) != "next" {
+		t.Errorf("expected %q, got %q, %v", "next", buf[:n], err)
+	}
+	n, err = nb.ReadInterByte(buf[:], interByte, interByte)
+	if err == nil || n != 0 {
+		t.Errorf("expected timeout error with no response, got %d, %v", n, err)
 	}
 }
 
-func TestNonBlockingReset(t *testing.T) {
-	t.Parallel()
-	const (
-		block   = 100 * time.Millisecond
-		timeout = 5 * time.Millisecond
-		data    = "hello partner!"
-	)
-	rwc := &readwritecloser{
+func TestPoller(t *testing.T) {
+	const nports = 100
+	p := cereal.NewPoller()
+	before := runtime.NumGoroutine()
+	ports := make([]*readwritecloser, nports)
+	nbs := make([]*cereal.NonBlocking, nports)
+	for i := range ports {
+		ports[i] = newPollLoopback()
+		nbs[i] = p.NewNonBlocking(ports[i], cereal.NonBlockingConfig{ReadTimeout: time.Second})
+	}
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("expected ports to share the poller goroutine, goroutines went from %d to %d", before, n)
+	}
+	for i, port := range ports {
+		port.Write([]byte(strconv.Itoa(i)))
+	}
+	for i, nb := range nbs {
+		buf := make([]byte, len(strconv.Itoa(i)))
+		n, err := nb.Read(buf)
+		if err != nil || string(buf[:n]) != strconv.Itoa(i) {
+			t.Fatalf("port %d: expected %q, got %q, %v", i, strconv.Itoa(i), buf[:n], err)
+		}
+	}
+	// A panicking reader terminates without affecting the others.
+	panicking := p.NewNonBlocking(&readwritecloser{}, cereal.NonBlockingConfig{
+		ReadFunc: func([]byte) (int, error) { panic("read") },
+	})
+	select {
+	case <-panicking.Done():
+	case <-time.After(time.Second):
+		t.Fatal("panicking reader not terminated")
+	}
+	if _, err := panicking.Read(nil); !errors.Is(err, cereal.ErrReaderPanicked) {
+		t.Error("expected ErrReaderPanicked, got", err)
+	}
+	nbs[0].Close()
+	select {
+	case <-nbs[0].Done():
+	case <-time.After(time.Second):
+		t.Fatal("closed port not terminated")
+	}
+	if n := p.Len(); n != nports-1 {
+		t.Errorf("expected %d ports left in poller, got %d", nports-1, n)
+	}
+	lazy := p.NewNonBlocking(newPollLoopback(), cereal.NonBlockingConfig{LazyStart: true})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, nb := range append(nbs, lazy) {
+		select {
+		case <-nb.Done():
+		default:
+			t.Fatal("expected all ports terminated after Close")
+		}
+	}
+	if p.Len() != 0 {
+		t.Error("expected no ports after Close")
+	}
+}
+
+// newPollLoopback returns a loopback port whose reads return immediately when there is no data.
+func newPollLoopback() *readwritecloser {
+	data := make(chan []byte, 64)
+	return &readwritecloser{
 		read: func(b []byte) (int, error) {
-			time.Sleep(block)
-			return copy(b, data), nil
+			select {
+			case d := <-data:
+				return copy(b, d), nil
+			default:
+				return 0, nil
+			}
+		},
+		write: func(b []byte) (int, error) {
+			data <- append([]byte(nil), b...)
+			return len(b), nil
 		},
 	}
+}
 
-	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
-		ReadTimeout: timeout,
-	})
-	// This call should fail with deadline exceeded.
-	buf := make([]byte, len(data))
-	n, err := nb.Read(buf)
-	if n != 0 || err == nil {
-		t.Fatal("unexpected NonBlocking behaviour", n, err)
+func TestNonBlockingTransact(t *testing.T) {
+	port := newLoopback()
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	port.Write([]byte("late response\n"))
+	for nb.Buffered() == 0 {
+		time.Sleep(time.Millisecond)
 	}
-	time.Sleep(block)
-	nb.Reset()
-	n, _ = nb.Read(buf)
+	resp, err := nb.Transact([]byte("ping\nextra"), '\n', time.Second)
+	if err != nil || string(resp) != "ping\n" {
+		t.Fatalf("expected %q; got %q, %v", "ping\n", resp, err)
+	}
+	var buf [8]byte
+	n, _ := nb.ReadDeadline(buf[:5], time.Now().Add(time.Second))
+	if string(buf[:n]) != "extra" {
+		t.Errorf("expected bytes after delimiter left buffered, got %q", buf[:n])
+	}
+	resp, err = nb.Transact([]byte("no delimiter"), '\n', 50*time.Millisecond)
+	if err == nil || string(resp) != "no delimiter" {
+		t.Errorf("expected partial response with timeout error, got %q, %v", resp, err)
+	}
+}
+
+func TestNonBlockingReader(t *testing.T) {
+	closed := false
+	sent := false
+	src := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			if sent {
+				time.Sleep(time.Millisecond)
+				return 0, nil
+			}
+			sent = true
+			return copy(b, "data"), nil
+		},
+		close: func() error { closed = true; return nil },
+	}
+	nb := cereal.NewNonBlockingReader(src, cereal.NonBlockingConfig{ReadTimeout: time.Second})
+	_, err := nb.Write([]byte("x"))
+	if err != cereal.ErrNotWritable {
+		t.Error("expected ErrNotWritable, got", err)
+	}
+	_, err = nb.WriteString("x")
+	if err != cereal.ErrNotWritable {
+		t.Error("expected ErrNotWritable writing string, got", err)
+	}
+	var buf [4]byte
+	n, err := nb.Read(buf[:])
+	if err != nil || string(buf[:n]) != "data" {
+		t.Fatalf("expected %q; got %q, %v", "data", buf[:n], err)
+	}
+	err = nb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed {
+		t.Error("expected source left open")
+	}
+	_, err = nb.Read(buf[:])
+	if err != io.EOF {
+		t.Error("expected io.EOF after Close, got", err)
+	}
+}
+
+func TestNonBlockingReadFunc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// The port's read callback is nil and panics if called.
+	nb := cereal.NewNonBlocking(&readwritecloser{}, cereal.NonBlockingConfig{
+		ReadTimeout: time.Second,
+		ReadFunc: func(b []byte) (int, error) {
+			select {
+			case <-ctx.Done():
+				return 0, io.EOF
+			case <-time.After(time.Millisecond):
+				return copy(b, "ctx"), nil
+			}
+		},
+	})
+	var buf [3]byte
+	n, err := nb.Read(buf[:])
+	if err != nil || string(buf[:n]) != "ctx" {
+		t.Fatalf("expected %q; got %q, %v", "ctx", buf[:n], err)
+	}
+	cancel()
+	for err == nil {
+		_, err = nb.Read(buf[:])
+	}
+	if err != io.EOF {
+		t.Error("expected io.EOF after cancel, got", err)
+	}
+}
+
+func TestNonBlockingWriteAfterClose(t *testing.T) {
+	writes := 0
+	nb := cereal.NewNonBlocking(&readwritecloser{
+		write: func(b []byte) (int, error) {
+			writes++
+			return 0, errors.New("backend specific error")
+		},
+	}, cereal.NonBlockingConfig{LazyStart: true})
+	nb.Close()
+	for name, write := range map[string]func() (int, error){
+		"Write":       func() (int, error) { return nb.Write([]byte("a")) },
+		"WriteFrame":  func() (int, error) { return nb.WriteFrame([]byte("a")) },
+		"WriteString": func() (int, error) { return nb.WriteString("a") },
+	} {
+		n, err := write()
+		if n != 0 || err != cereal.ErrClosed || !errors.Is(err, net.ErrClosed) {
+			t.Errorf("%s: expected ErrClosed wrapping net.ErrClosed, got %d, %v", name, n, err)
+		}
+	}
+	if writes != 0 {
+		t.Error("expected no writes to reach the closed port")
+	}
+}
+
+func TestNonBlockingSoftwareFlowControl(t *testing.T) {
+	data := make(chan []byte, 8)
+	written := make(chan []byte, 8)
+	nb := cereal.NewNonBlocking(&readwritecloser{
+		read: func(b []byte) (int, error) { return copy(b, <-data), nil },
+		write: func(b []byte) (int, error) {
+			written <- append([]byte(nil), b...)
+			return len(b), nil
+		},
+	}, cereal.NonBlockingConfig{ReadTimeout: time.Second, SoftwareFlowControl: true})
+	data <- []byte("ab\x13cd")
+	buf := make([]byte, 4)
+	n, err := nb.Read(buf)
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Fatalf("expected XOFF removed from data, got %q, %v", buf[:n], err)
+	}
+	go nb.Write([]byte("hi"))
+	select {
+	case <-written:
+		t.Fatal("write not paused by XOFF")
+	case <-time.After(50 * time.Millisecond):
+	}
+	data <- []byte{0x11}
+	select {
+	case got := <-written:
+		if string(got) != "hi" {
+			t.Errorf("expected %q written after XON, got %q", "hi", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write not resumed by XON")
+	}
+
+	// Close releases paused writes.
+	data <- []byte{0x13}
+	time.Sleep(50 * time.Millisecond)
+	errc := make(chan error)
+	go func() {
+		_, err := nb.Write([]byte("x"))
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	nb.Close()
+	select {
+	case err := <-errc:
+		if err != cereal.ErrClosed {
+			t.Error("expected ErrClosed, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("paused write not released by Close")
+	}
+}
+
+func TestNonBlockingCloseIdempotent(t *testing.T) {
+	errClose := errors.New("close failed")
+	var mu sync.Mutex
+	closes := 0
+	nb := cereal.NewNonBlocking(&readwritecloser{
+		read: func(b []byte) (int, error) {
+			time.Sleep(time.Millisecond)
+			return 0, nil
+		},
+		close: func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			closes++
+			return errClose
+		},
+	}, cereal.NonBlockingConfig{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := nb.Close(); err != errClose {
+				t.Error("expected first close error on every call, got", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if closes != 1 {
+		t.Errorf("expected underlying port closed once, got %d", closes)
+	}
+}
+
+func TestNonBlockingReaderPanic(t *testing.T) {
+	nb := cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		panic("driver bug")
+	}}, cereal.NonBlockingConfig{ReadTimeout: time.Second})
+	var buf [1]byte
+	_, err := nb.Read(buf[:])
+	if !errors.Is(err, cereal.ErrReaderPanicked) {
+		t.Fatal("expected ErrReaderPanicked, got", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "driver bug") || !strings.Contains(msg, "goroutine") {
+		t.Errorf("expected panic value and stack in error message, got %q", msg)
+	}
+}
+
+func TestNonBlockingTransientError(t *testing.T) {
+	errTransient := errors.New("transient")
+	failures := 0
+	nb := cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		if failures < 2 {
+			failures++
+			return 0, errTransient
+		} else if failures == 2 {
+			failures++
+			return copy(b, "ok"), nil
+		}
+		return 0, errTransient
+	}}, cereal.NonBlockingConfig{ReadTimeout: time.Second, MaxReadErrors: 3})
+	var buf [2]byte
+	n, err := nb.Read(buf[:])
+	if err != nil || string(buf[:n]) != "ok" {
+		t.Fatalf("expected transient errors to be retried, got %q, %v", buf[:n], err)
+	}
+	_, err = nb.Read(buf[:])
+	if err != errTransient {
+		t.Fatal("expected sticky error after consecutive failures, got", err)
+	}
+	stats := nb.Stats()
+	if stats.Reads != 6 || stats.BackoffSleeps < 4 {
+		t.Errorf("expected 6 reads with backoff between failures, got %+v", stats)
+	}
+}
+
+func TestNonBlockingTimeoutError(t *testing.T) {
+	nb := cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		time.Sleep(time.Millisecond)
+		return 0, nil
+	}}, cereal.NonBlockingConfig{ReadTimeout: 10 * time.Millisecond})
+	var buf [1]byte
+	_, err := nb.Read(buf[:])
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("expected timeout error to be os.ErrDeadlineExceeded, got", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || !netErr.Temporary() {
+		t.Error("expected timeout error to be a temporary net.Error timeout, got", err)
+	}
+	if !errors.As(cereal.ErrWriteTimeout, &netErr) || !netErr.Timeout() {
+		t.Error("expected ErrWriteTimeout to be a net.Error timeout")
+	}
+	nb.Close()
+	_, err = nb.Read(buf[:])
+	if err != io.EOF || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("expected io.EOF after close, got", err)
+	}
+}
+
+func TestNonBlockingBlocked(t *testing.T) {
+	t.Parallel()
+	const (
+		block   = 100 * time.Millisecond
+		timeout = 5 * time.Millisecond
+		data    = "hello partner!"
+	)
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			time.Sleep(block)
+			return copy(b, data), nil
+		},
+	}
+
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
+		ReadTimeout: timeout,
+	})
+	// This call should fail with deadline exceeded.
+	buf := make([]byte, len(data))
+	n, err := nb.Read(buf)
+	if n != 0 || err == nil {
+		t.Fatal("unexpected NonBlocking behaviour", n, err)
+	}
+	time.Sleep(block - timeout)
+	n, err = nb.Read(buf)
+	if n != len(buf) || err != nil {
+		t.Fatal("expected to read blocked data", n, err)
+	}
+
+	if string(buf) != data {
+		t.Errorf("expected %q; got %q", data, buf)
+	}
+}
+
+func TestNonBlockingReset(t *testing.T) {
+	t.Parallel()
+	const (
+		block   = 100 * time.Millisecond
+		timeout = 5 * time.Millisecond
+		data    = "hello partner!"
+	)
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			time.Sleep(block)
+			return copy(b, data), nil
+		},
+	}
+
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
+		ReadTimeout: timeout,
+	})
+	// This call should fail with deadline exceeded.
+	buf := make([]byte, len(data))
+	n, err := nb.Read(buf)
+	if n != 0 || err == nil {
+		t.Fatal("unexpected NonBlocking behaviour", n, err)
+	}
+	time.Sleep(block)
+	nb.Reset()
+	n, _ = nb.Read(buf)
 	if n != 0 {
 		t.Fatal("expected data to have been completely reset, got", string(buf[:n]))
 	}
 }
 
+func TestNonBlockingCustomBuffer(t *testing.T) {
+	t.Parallel()
+	const data = "hello partner!"
+	src := bytes.NewBufferString(data)
+	custom := &countingBuffer{}
+	nb := cereal.NewNonBlocking(nop{ReadWriter: src, Closer: io.NopCloser(src)}, cereal.NonBlockingConfig{
+		ReadTimeout: 50 * time.Millisecond,
+		Buffer:      custom,
+	})
+	buf := make([]byte, len(data))
+	n, err := nb.Read(buf)
+	if err != nil || string(buf[:n]) != data {
+		t.Fatal("unexpected read", n, err, string(buf[:n]))
+	}
+	if custom.writes == 0 {
+		t.Error("custom buffer was not written to")
+	}
+}
+
+type countingBuffer struct {
+	bytes.Buffer
+	writes int
+}
+
+func (cb *countingBuffer) Write(b []byte) (int, error) {
+	cb.writes++
+	return cb.Buffer.Write(b)
+}
+
+func TestNonBlockingSmallBuffer(t *testing.T) {
+	t.Parallel()
+	var data [1024]byte
+	for i := range data {
+		data[i] = byte(rand.Intn(256))
+	}
+	src := bytes.NewBuffer(data[:])
+	// Small buffered capacity forces the internal ring to wrap around many times.
+	nb := cereal.NewNonBlocking(nop{ReadWriter: src, Closer: io.NopCloser(src)}, cereal.NonBlockingConfig{
+		ReadTimeout:     50 * time.Millisecond,
+		MaxReadBuffered: 37,
+		MaxReadSize:     16,
+	})
+	got := make([]byte, 0, len(data))
+	smallbuf := make([]byte, 11)
+	for len(got) < len(data) {
+		n, err := nb.Read(smallbuf)
+		got = append(got, smallbuf[:n]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nb.Buffered() > 37 {
+			t.Fatal("buffered exceeds MaxReadBuffered", nb.Buffered())
+		}
+	}
+	if !bytes.Equal(got, data[:]) {
+		t.Fatal("mismatch in data read")
+	}
+}
+
+func TestNonBlockingBackpressure(t *testing.T) {
+	port := newLoopback()
+	full := make(chan int, 4)
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{
+		MaxReadBuffered: 4,
+		OnBackpressure: func(buffered int) {
+			full <- buffered
+		},
+	})
+	defer nb.Close()
+	port.Write([]byte("abcd"))
+	select {
+	case buffered := <-full:
+		if buffered != 4 {
+			t.Errorf("expected 4 bytes buffered, got %d", buffered)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnBackpressure not called with full buffer")
+	}
+	// Not called again until the buffer fills again.
+	time.Sleep(50 * time.Millisecond)
+	if len(full) != 0 {
+		t.Error("expected a single call per full buffer")
+	}
+	nb.Read(make([]byte, 4))
+	port.Write([]byte("efgh"))
+	select {
+	case <-full:
+	case <-time.After(time.Second):
+		t.Fatal("OnBackpressure not called after buffer filled again")
+	}
+}
+
+func TestEffectiveBuffered(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("hello world"))
+	nb := cereal.NewNonBlockingReader(br, cereal.NonBlockingConfig{MaxReadBuffered: 4})
+	defer nb.Close()
+	if err := nb.WaitFor(4, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got := cereal.EffectiveBuffered(nb); nb.Buffered() != 4 || got != 11 {
+		t.Errorf("expected 4 bytes buffered by NonBlocking and 11 in total, got %d and %d", nb.Buffered(), got)
+	}
+	if got := cereal.EffectiveBuffered(strings.NewReader("abc")); got != 0 {
+		t.Errorf("expected no bytes buffered by unknown reader, got %d", got)
+	}
+}
+
+func TestNonBlockingReadSizeOverBuffered(t *testing.T) {
+	const maxBuffered = 4
+	var mu sync.Mutex
+	largestRead := 0
+	nb := cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		mu.Lock()
+		if len(b) > largestRead {
+			largestRead = len(b)
+		}
+		mu.Unlock()
+		for i := range b {
+			b[i] = 'x'
+		}
+		return len(b), nil
+	}}, cereal.NonBlockingConfig{MaxReadBuffered: maxBuffered, MaxReadSize: 1 << 20})
+	var buf [3]byte
+	for i := 0; i < 20; i++ {
+		if n := nb.Buffered(); n > maxBuffered {
+			t.Fatalf("buffered %d bytes over MaxReadBuffered=%d", n, maxBuffered)
+		}
+		nb.Read(buf[:])
+		time.Sleep(time.Millisecond)
+	}
+	nb.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if largestRead > maxBuffered {
+		t.Errorf("read of %d bytes requested over MaxReadBuffered=%d", largestRead, maxBuffered)
+	}
+}
+
+func TestNonBlockingZeroTimeoutPartial(t *testing.T) {
+	t.Parallel()
+	const data = "hello partner!"
+	src := bytes.NewBufferString(data)
+	nb := cereal.NewNonBlocking(nop{ReadWriter: src, Closer: io.NopCloser(src)}, cereal.NonBlockingConfig{})
+	// Wait for the background goroutine to buffer all data.
+	for i := 0; nb.Buffered() < len(data); i++ {
+		if i > 100 {
+			t.Fatal("data was not buffered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	buf := make([]byte, 4*len(data))
+	n, err := nb.Read(buf)
+	if string(buf[:n]) != data {
+		t.Fatalf("expected %q; got %q", data, buf[:n])
+	}
+	if err != nil && err != io.EOF {
+		t.Fatal("unexpected error on partial read", err)
+	}
+	n, err = nb.Read(buf)
+	if n != 0 {
+		t.Fatal("expected empty read after buffer drained", n, err)
+	}
+}
+
+func TestNonBlockingWriteToReadFrom(t *testing.T) {
+	t.Parallel()
+	var data [4096]byte
+	for i := range data {
+		data[i] = byte(rand.Intn(256))
+	}
+	src := bytes.NewBuffer(data[:])
+	var written bytes.Buffer
+	rwc := &readwritecloser{
+		read:  src.Read,
+		write: written.Write,
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
+		ReadTimeout: 20 * time.Millisecond,
+	})
+	var dst bytes.Buffer
+	n, err := nb.WriteTo(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data[:]) {
+		t.Fatal("mismatch in data written to destination", n)
+	}
+
+	n, err = nb.ReadFrom(bytes.NewReader(data[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(written.Bytes(), data[:]) {
+		t.Fatal("mismatch in data read from source", n)
+	}
+}
+
+func TestNonBlockingWriteToIdle(t *testing.T) {
+	t.Parallel()
+	nb := cereal.NewNonBlocking(discardPort{}, cereal.NonBlockingConfig{
+		ReadTimeout: 5 * time.Millisecond,
+	})
+	defer nb.Close()
+	var dst bytes.Buffer
+	n, err := nb.WriteTo(&dst)
+	if n != 0 || err != nil {
+		t.Fatal("expected idle bus to return cleanly", n, err)
+	}
+}
+
+func TestNonBlockingLogger(t *testing.T) {
+	t.Parallel()
+	const data = "hello partner!"
+	src := bytes.NewBufferString(data)
+	var mu sync.Mutex
+	events := make(map[string]int)
+	var logged []byte
+	nb := cereal.NewNonBlocking(nop{ReadWriter: src, Closer: io.NopCloser(src)}, cereal.NonBlockingConfig{
+		ReadTimeout: 5 * time.Millisecond,
+		Logger: func(event string, b []byte, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[event]++
+			logged = append(logged, b...)
+		},
+	})
+	buf := make([]byte, 2*len(data))
+	nb.Read(buf) // Read times out since buf is not filled.
+	mu.Lock()
+	defer mu.Unlock()
+	if string(logged) != data {
+		t.Errorf("expected logged data %q; got %q", data, logged)
+	}
+	if events["read"] == 0 || events["timeout"] == 0 || events["error"] > 1 {
+		t.Error("missing events", events)
+	}
+}
+
+func TestNonBlockingSetMaxReadSize(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var sizes []int
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			sizes = append(sizes, len(b))
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			return 0, nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{MaxReadSize: 16})
+	defer nb.Close()
+	time.Sleep(5 * time.Millisecond)
+	nb.SetMaxReadSize(3)
+	time.Sleep(200 * time.Millisecond) // Wait for backoff.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sizes) < 2 || sizes[0] != 16 || sizes[len(sizes)-1] != 3 {
+		t.Fatal("read size not changed", sizes)
+	}
+}
+
+func TestNonBlockingWriteFrame(t *testing.T) {
+	t.Parallel()
+	const (
+		writers   = 8
+		frames    = 20
+		frameSize = 16
+	)
+	var mu sync.Mutex
+	var wire []byte
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) { return 0, nil },
+		write: func(b []byte) (int, error) {
+			// Short writes without error like some serial ports do.
+			if len(b) > 3 {
+				b = b[:3]
+			}
+			mu.Lock()
+			wire = append(wire, b...)
+			mu.Unlock()
+			time.Sleep(10 * time.Microsecond)
+			return len(b), nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			frame := bytes.Repeat([]byte{id}, frameSize)
+			for j := 0; j < frames; j++ {
+				n, err := nb.WriteFrame(frame)
+				if n != frameSize || err != nil {
+					t.Error("short frame write", n, err)
+				}
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+	if len(wire) != writers*frames*frameSize {
+		t.Fatal("unexpected amount of bytes written", len(wire))
+	}
+	for i := 0; i < len(wire); i += frameSize {
+		frame := wire[i : i+frameSize]
+		if !bytes.Equal(frame, bytes.Repeat(frame[:1], frameSize)) {
+			t.Fatalf("frame interleaved: %v", frame)
+		}
+	}
+}
+
+func TestNonBlockingStats(t *testing.T) {
+	t.Parallel()
+	const data = "hello partner!"
+	var mu sync.Mutex
+	reads := 0
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reads++
+			if reads == 1 {
+				return copy(b, data), nil
+			}
+			return 0, nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{})
+	time.Sleep(10 * time.Millisecond)
+	nb.Close()
+	stats := nb.Stats()
+	if stats.BytesRead != uint64(len(data)) {
+		t.Errorf("expected %d bytes read; got %d", len(data), stats.BytesRead)
+	}
+	if stats.Reads < 2 || stats.EmptyReads != stats.Reads-1 || stats.BackoffSleeps < stats.EmptyReads-1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCopyUntilIdle(t *testing.T) {
+	t.Parallel()
+	const (
+		chunk = "burst"
+		gap   = 5 * time.Millisecond
+	)
+	var mu sync.Mutex
+	reads := 0
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reads++
+			if reads > 3 {
+				return 0, nil // Bus goes quiet.
+			}
+			time.Sleep(gap)
+			return copy(b, chunk), nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	var dst bytes.Buffer
+	n, err := cereal.CopyUntilIdle(&dst, nb, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3*int64(len(chunk)) || dst.String() != chunk+chunk+chunk {
+		t.Fatalf("unexpected data copied %q", dst.String())
+	}
+}
+
+func TestNonBlockingDisconnect(t *testing.T) {
+	t.Parallel()
+	const data = "last words"
+	var mu sync.Mutex
+	reads := 0
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reads++
+			if reads == 1 {
+				return copy(b, data), nil
+			}
+			return 0, &os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.EIO}
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{ReadTimeout: 20 * time.Millisecond})
+	buf := make([]byte, 64)
+	n, err := nb.Read(buf)
+	if string(buf[:n]) != data {
+		t.Fatalf("expected %q before disconnect; got %q", data, buf[:n])
+	}
+	n, err = nb.Read(buf)
+	if n != 0 || !errors.Is(err, cereal.ErrPortDisconnected) || !errors.Is(err, syscall.EIO) {
+		t.Fatal("expected disconnect error", n, err)
+	}
+}
+
+func TestNonBlockingCloseKeepsEOF(t *testing.T) {
+	closed := make(chan struct{})
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			<-closed
+			// The read in progress fails due to Close with an error that also indicates a disconnect.
+			return 0, &os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.EIO}
+		},
+		close: func() error {
+			close(closed)
+			return nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{})
+	time.Sleep(10 * time.Millisecond) // Let the reader block.
+	nb.Close()
+	<-nb.Done()
+	_, err := nb.Read(make([]byte, 8))
+	if err != io.EOF {
+		t.Fatal("expected io.EOF after Close, got", err)
+	}
+}
+
+func TestNonBlockingLazyStart(t *testing.T) {
+	t.Parallel()
+	const data = "hello partner!"
+	var mu sync.Mutex
+	reads := 0
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reads++
+			if reads == 1 {
+				return copy(b, data), nil
+			}
+			return 0, nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{
+		ReadTimeout: 50 * time.Millisecond,
+		LazyStart:   true,
+	})
+	defer nb.Close()
+	time.Sleep(5 * time.Millisecond)
+	mu.Lock()
+	if reads != 0 {
+		t.Error("reader goroutine started before first read")
+	}
+	mu.Unlock()
+	buf := make([]byte, len(data))
+	n, err := nb.Read(buf)
+	if err != nil || string(buf[:n]) != data {
+		t.Fatal("unexpected lazy read", n, err)
+	}
+}
+
+func TestNonBlockingDiscardFor(t *testing.T) {
+	t.Parallel()
+	const (
+		noise = "boot noise"
+		data  = "ready"
+	)
+	start := time.Now()
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			time.Sleep(time.Millisecond)
+			if time.Since(start) < 30*time.Millisecond {
+				return copy(b, noise), nil
+			}
+			return copy(b, data), nil
+		},
+	}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{ReadTimeout: 20 * time.Millisecond})
+	defer nb.Close()
+	nb.DiscardFor(40 * time.Millisecond)
+	buf := make([]byte, len(data))
+	n, err := nb.Read(buf)
+	if err != nil || string(buf[:n]) != data {
+		t.Fatalf("expected clean read of %q; got %q, %v", data, buf[:n], err)
+	}
+}
+
+func TestNonBlockingUnderlying(t *testing.T) {
+	t.Parallel()
+	rwc := &readwritecloser{read: func(b []byte) (int, error) { return 0, nil }}
+	nb := cereal.NewNonBlocking(rwc, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	if nb.Underlying() != rwc {
+		t.Fatal("expected underlying port to be wrapped port")
+	}
+}
+
+func BenchmarkNonBlockingThroughput(b *testing.B) {
+	const size = 64 * 1024
+	for _, bb := range []struct {
+		name string
+		buf  func() cereal.Buffer
+	}{
+		{name: "ring", buf: func() cereal.Buffer { return nil }},
+		{name: "bytes.Buffer", buf: func() cereal.Buffer { return &bytes.Buffer{} }},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			data := make([]byte, size)
+			readbuf := make([]byte, 512)
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				src := bytes.NewBuffer(data)
+				// Zero ReadTimeout so Read spins instead of sleeping when the buffer is empty.
+				nb := cereal.NewNonBlocking(nop{ReadWriter: src, Closer: io.NopCloser(src)}, cereal.NonBlockingConfig{
+					MaxReadBuffered: 4096,
+					Buffer:          bb.buf(),
+				})
+				for n := 0; n < size; {
+					nn, err := nb.Read(readbuf)
+					if err != nil {
+						b.Fatal(err)
+					}
+					n += nn
+				}
+				nb.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkNonBlockingBuffered(b *testing.B) {
+	// The background goroutine reads continuously while callers poll Buffered and consume data.
+	nb := cereal.NewNonBlocking(&readwritecloser{
+		read: func(b []byte) (int, error) { return len(b), nil },
+	}, cereal.NonBlockingConfig{MaxReadBuffered: 4096, MaxReadSize: 64})
+	defer nb.Close()
+	b.RunParallel(func(pb *testing.PB) {
+		var buf [64]byte
+		for pb.Next() {
+			if nb.Buffered() >= len(buf) {
+				nb.Read(buf[:])
+			}
+		}
+	})
+}
+
+func BenchmarkNonBlockingWriteString(b *testing.B) {
+	const cmd = "AT+GMR\r\n"
+	nb := cereal.NewNonBlocking(discardPort{}, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	var s = cmd // Prevent constant folding of conversion.
+	b.Run("Write", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nb.Write([]byte(s))
+		}
+	})
+	b.Run("WriteString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nb.WriteString(s)
+		}
+	})
+}
+
+// discardPort never returns data on Read and discards all writes.
+type discardPort struct{}
+
+func (discardPort) Read(b []byte) (int, error)        { return 0, nil }
+func (discardPort) Write(b []byte) (int, error)       { return len(b), nil }
+func (discardPort) WriteString(s string) (int, error) { return len(s), nil }
+func (discardPort) Close() error                      { return nil }
+
+func TestRecorder(t *testing.T) {
+	const (
+		request  = "AT\r\n"
+		response = "OK\r\n"
+	)
+	var capture bytes.Buffer
+	rec := cereal.NewRecorder(&readwritecloser{
+		read: func(b []byte) (int, error) { return copy(b, response), nil },
+	}, &capture)
+	_, err := rec.Write([]byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := rec.Read(buf)
+	if err != nil || string(buf[:n]) != response {
+		t.Fatal("unexpected read through recorder", n, err)
+	}
+	if rec.Err() != nil {
+		t.Fatal(rec.Err())
+	}
+
+	cr := cereal.NewCaptureReader(&capture)
+	for _, expect := range []struct {
+		dir  cereal.Direction
+		data string
+	}{
+		{dir: cereal.DirWrite, data: request},
+		{dir: cereal.DirRead, data: response},
+	} {
+		record, err := cr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Dir != expect.dir || string(record.Data) != expect.data {
+			t.Errorf("expected %s %q; got %s %q", expect.dir, expect.data, record.Dir, record.Data)
+		}
+		if time.Since(record.Time) > time.Second {
+			t.Error("bad record timestamp", record.Time)
+		}
+	}
+	_, err = cr.Next()
+	if err != io.EOF {
+		t.Error("expected EOF at end of capture, got", err)
+	}
+}
+
+func TestCaptureReaderCorrupt(t *testing.T) {
+	var capture bytes.Buffer
+	rec := cereal.NewRecorder(&readwritecloser{
+		write: func(b []byte) (int, error) { return len(b), nil },
+	}, &capture)
+	// Writes longer than a record are split.
+	large := bytes.Repeat([]byte{'x'}, 1<<20+1)
+	_, err := rec.Write(large)
+	if err != nil || rec.Err() != nil {
+		t.Fatal(err, rec.Err())
+	}
+	cr := cereal.NewCaptureReader(&capture)
+	var got []byte
+	for {
+		record, err := cr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record.Data...)
+	}
+	if !bytes.Equal(got, large) {
+		t.Errorf("expected %d bytes written, got %d", len(large), len(got))
+	}
+
+	// A corrupt length must not be trusted for allocating the record.
+	corrupt := []byte{0, 0, 0, 0, 0, 0, 0, 0, byte(cereal.DirRead), 0xff, 0xff, 0xff, 0xff, 'a'}
+	_, err = cereal.NewCaptureReader(bytes.NewReader(corrupt)).Next()
+	if err == nil || err == io.ErrUnexpectedEOF {
+		t.Error("expected invalid capture error for corrupt length, got", err)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	var dump strings.Builder
+	port := cereal.HexDump(newLoopback(), &dump)
+	port.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	n, err := port.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected data passed through, got %q, %v", buf[:n], err)
+	}
+	lines := strings.Split(dump.String(), "\n")
+	if len(lines) != 5 || !strings.HasSuffix(lines[0], " W 5") || !strings.HasSuffix(lines[2], " R 5") ||
+		lines[1] != lines[3] || !strings.Contains(lines[1], "68 65 6c 6c 6f") || !strings.HasSuffix(lines[1], "|hello|") {
+		t.Errorf("unexpected dump:\n%s", dump.String())
+	}
+}
+
+func TestReplayPort(t *testing.T) {
+	t.Parallel()
+	const (
+		request  = "AT\r\n"
+		response = "OK\r\n"
+		delay    = 20 * time.Millisecond
+	)
+	var capture bytes.Buffer
+	rec := cereal.NewRecorder(&readwritecloser{
+		read: func(b []byte) (int, error) {
+			time.Sleep(delay)
+			return copy(b, response), nil
+		},
+	}, &capture)
+	rec.Write([]byte(request))
+	rec.Read(make([]byte, 16))
+
+	port := cereal.NewReplayPort(&capture)
+	start := time.Now()
+	_, err := port.Write([]byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := port.Read(buf)
+	elapsed := time.Since(start)
+	if err != nil || string(buf[:n]) != response {
+		t.Fatal("unexpected replayed response", n, err)
+	}
+	if elapsed < delay/2 {
+		t.Error("response replayed too early", elapsed)
+	}
+	_, err = port.Read(buf)
+	if err != io.EOF {
+		t.Error("expected EOF at end of replay, got", err)
+	}
+}
+
+func TestReplayPortClose(t *testing.T) {
+	// Two reads recorded an hour apart.
+	var capture bytes.Buffer
+	start := time.Now()
+	for i, data := range []string{"a", "b"} {
+		var hdr [13]byte
+		binary.BigEndian.PutUint64(hdr[0:8], uint64(start.Add(time.Duration(i)*time.Hour).UnixNano()))
+		hdr[8] = byte(cereal.DirRead)
+		binary.BigEndian.PutUint32(hdr[9:13], uint32(len(data)))
+		capture.Write(hdr[:])
+		capture.WriteString(data)
+	}
+	port := cereal.NewReplayPort(&capture)
+	buf := make([]byte, 16)
+	n, err := port.Read(buf)
+	if err != nil || string(buf[:n]) != "a" {
+		t.Fatal("unexpected first record", buf[:n], err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		port.Close()
+	}()
+	start = time.Now()
+	n, err = port.Read(buf)
+	if err != io.EOF || n != 0 {
+		t.Errorf("expected io.EOF reading closed port, got %q, %v", buf[:n], err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Close did not interrupt the wait for the next record", elapsed)
+	}
+}
+
+func TestOpenWithTimeout(t *testing.T) {
+	var opened cereal.Mode
+	o := noTimeoutOpener{openerFunc(func(portname string, mode cereal.Mode) (io.ReadWriteCloser, error) {
+		opened = mode
+		return newLoopback(), nil
+	})}
+	const timeout = 20 * time.Millisecond
+	port, err := cereal.OpenWithTimeout(o, "loop", cereal.Mode{BaudRate: 9600, ReadTimeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	if opened.ReadTimeout != 0 {
+		t.Error("expected port opened without read timeout, got", opened.ReadTimeout)
+	}
+	start := time.Now()
+	_, err = port.Read(make([]byte, 1))
+	if !errors.Is(err, cereal.ErrReadTimeout) || time.Since(start) < timeout {
+		t.Errorf("expected read to time out after %s, got %v after %s", timeout, err, time.Since(start))
+	}
+	// Like the backends supporting read timeouts, received data is returned without waiting to fill b.
+	_, err = port.Write([]byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := port.Read(buf)
+	if err != nil || string(buf[:n]) != "hi" {
+		t.Errorf("expected to read %q, got %q, %v", "hi", buf[:n], err)
+	}
+}
+
+type noTimeoutOpener struct{ openerFunc }
+
+func (noTimeoutOpener) Capabilities() cereal.Capabilities { return cereal.Capabilities{} }
+
+type openerFunc func(portname string, mode cereal.Mode) (io.ReadWriteCloser, error)
+
+func (fn openerFunc) OpenPort(portname string, mode cereal.Mode) (io.ReadWriteCloser, error) {
+	return fn(portname, mode)
+}
+
+type portErrorer struct {
+	readwritecloser
+	framing, parity, overrun uint64
+}
+
+func (pe *portErrorer) PortErrors() (framing, parity, overrun uint64, err error) {
+	return pe.framing, pe.parity, pe.overrun, nil
+}
+
+func TestTransmitDuration(t *testing.T) {
+	for _, tc := range []struct {
+		mode   cereal.Mode
+		n      int
+		expect time.Duration
+	}{
+		{mode: cereal.Mode{BaudRate: 9600}, n: 960, expect: time.Second},
+		{mode: cereal.Mode{BaudRate: 9600, DataBits: 8, Parity: cereal.ParityEven, StopBits: cereal.StopBits2}, n: 800, expect: time.Second},
+		{mode: cereal.Mode{BaudRate: 1000, DataBits: 7, StopBits: cereal.StopBits1Half}, n: 2, expect: 19 * time.Millisecond},
+		{mode: cereal.Mode{}, n: 100, expect: 0},
+	} {
+		got := tc.mode.TransmitDuration(tc.n)
+		if got != tc.expect {
+			t.Errorf("%+v: expected %s to transmit %d bytes; got %s", tc.mode, tc.expect, tc.n, got)
+		}
+	}
+}
+
+func TestHalfDuplex(t *testing.T) {
+	t.Parallel()
+	var events []string
+	rwc := &readwritecloser{
+		write: func(b []byte) (int, error) {
+			events = append(events, "write")
+			return len(b), nil
+		},
+	}
+	mode := cereal.Mode{BaudRate: 9600}
+	const guard = 2 * time.Millisecond
+	hd, err := cereal.NewHalfDuplex(rwc, cereal.HalfDuplexConfig{
+		Mode:      mode,
+		GuardTime: guard,
+		SetDirection: func(tx bool) error {
+			if tx {
+				events = append(events, "tx")
+			} else {
+				events = append(events, "rx")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 48)
+	start := time.Now()
+	n, err := hd.Write(data)
+	elapsed := time.Since(start)
+	if n != len(data) || err != nil {
+		t.Fatal(n, err)
+	}
+	if elapsed < mode.TransmitDuration(len(data))+guard {
+		t.Error("direction switched back before data cleared the wire", elapsed)
+	}
+	expect := []string{"rx", "tx", "write", "rx"}
+	if fmt.Sprint(events) != fmt.Sprint(expect) {
+		t.Errorf("expected direction events %v; got %v", expect, events)
+	}
+	if cereal.Unwrap(hd) != rwc {
+		t.Error("expected HalfDuplex to unwrap to its port")
+	}
+
+	_, err = cereal.NewHalfDuplex(rwc, cereal.HalfDuplexConfig{})
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported for port without RTS control, got", err)
+	}
+}
+
+func TestATClient(t *testing.T) {
+	t.Parallel()
+	responses := map[string]string{
+		"AT\r\n":     "AT\r\n\r\nOK\r\n",
+		"AT+GMR\r\n": "AT version:1.2.0.0\r\nSDK version:1.5.4\r\n\r\nOK\r\n",
+		"AT+BAD\r\n": "\r\nERROR\r\n",
+	}
+	var mu sync.Mutex
+	var pending []byte
+	rwc := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			n := copy(b, pending)
+			pending = pending[n:]
+			return n, nil
+		},
+		write: func(b []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			pending = append(pending, responses[string(b)]...)
+			return len(b), nil
+		},
+	}
+	at := cereal.NewATClient(rwc)
+	defer at.Close()
+	lines, err := at.Command("AT", time.Second)
+	if err != nil || len(lines) != 0 || at.Status() != "OK" {
+		t.Fatal("unexpected AT response", lines, err, at.Status())
+	}
+	lines, err = at.Command("AT+GMR", time.Second)
+	if err != nil || len(lines) != 2 || lines[1] != "SDK version:1.5.4" {
+		t.Fatal("unexpected AT+GMR response", lines, err)
+	}
+	_, err = at.Command("AT+BAD", time.Second)
+	if !errors.Is(err, cereal.ErrATFailed) || at.Status() != "ERROR" {
+		t.Fatal("expected AT error", err, at.Status())
+	}
+	_, err = at.Command("AT+NORESPONSE", 10*time.Millisecond)
+	if err == nil || at.Status() != "" {
+		t.Fatal("expected timeout error", err)
+	}
+}
+
+func TestParityInvalid(t *testing.T) {
+	invalid := cereal.Parity(200)
+	if _, err := invalid.CharErr(); err == nil {
+		t.Error("expected error for invalid parity")
+	}
+	if invalid.Char() != '?' {
+		t.Error("expected '?' for invalid parity")
+	}
+	if c, err := cereal.ParityEven.CharErr(); c != 'E' || err != nil {
+		t.Error("unexpected even parity char", c, err)
+	}
+	for _, o := range []cereal.Opener{cereal.Tarm{}, cereal.Goburrow{}, cereal.Bugst{}} {
+		_, err := o.OpenPort("/dev/cereal-nonexistent", cereal.Mode{BaudRate: 9600, Parity: invalid})
+		if err == nil || !strings.Contains(err.Error(), "parity") {
+			t.Errorf("%s: expected invalid parity error, got %v", o, err)
+		}
+	}
+}
+
+func TestParseStopBits(t *testing.T) {
+	for _, s := range []cereal.StopBits{cereal.StopBits1, cereal.StopBits1Half, cereal.StopBits2} {
+		got, err := cereal.ParseStopBits(s.String())
+		if err != nil || got != s {
+			t.Errorf("%s did not round trip: got %s, %v", s, got, err)
+		}
+	}
+	for _, invalid := range []string{"", "0", "3", "1.0", "one"} {
+		_, err := cereal.ParseStopBits(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing stop bits %q", invalid)
+		}
+	}
+}
+
+func TestParseParity(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		expect cereal.Parity
+	}{
+		{s: "none", expect: cereal.ParityNone},
+		{s: "ODD", expect: cereal.ParityOdd},
+		{s: "Even", expect: cereal.ParityEven},
+		{s: "mark", expect: cereal.ParityMark},
+		{s: "space", expect: cereal.ParitySpace},
+		{s: "n", expect: cereal.ParityNone},
+		{s: "E", expect: cereal.ParityEven},
+	} {
+		got, err := cereal.ParseParity(tc.s)
+		if err != nil || got != tc.expect {
+			t.Errorf("parsing %q: expected %s; got %s, %v", tc.s, tc.expect, got, err)
+		}
+		roundtrip, err := cereal.ParseParity(got.String())
+		if err != nil || roundtrip != got {
+			t.Errorf("%s did not round trip", got)
+		}
+	}
+	for _, invalid := range []string{"", "x", "nones", "<invalid parity>"} {
+		_, err := cereal.ParseParity(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing parity %q", invalid)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, tc := range []struct {
+		s         string
+		expect    cereal.Mode
+		canonical string
+	}{
+		{s: "115200,8,N,1", expect: cereal.Mode{BaudRate: 115200, DataBits: 8}, canonical: "115200,8,N,1"},
+		{s: "9600, 7, even, 2", expect: cereal.Mode{BaudRate: 9600, DataBits: 7, Parity: cereal.ParityEven, StopBits: cereal.StopBits2}, canonical: "9600,7,E,2"},
+		{s: "300,5,M,1.5,100ms", expect: cereal.Mode{BaudRate: 300, DataBits: 5, Parity: cereal.ParityMark, StopBits: cereal.StopBits1Half, ReadTimeout: 100 * time.Millisecond}, canonical: "300,5,M,1.5,100ms"},
+	} {
+		got, err := cereal.ParseMode(tc.s)
+		if err != nil {
+			t.Errorf("parsing %q: %s", tc.s, err)
+			continue
+		}
+		if got != tc.expect {
+			t.Errorf("parsing %q: expected %+v; got %+v", tc.s, tc.expect, got)
+		}
+		if got.String() != tc.canonical {
+			t.Errorf("expected canonical %q; got %q", tc.canonical, got.String())
+		}
+	}
+	for _, invalid := range []string{"", "9600", "9600,8,N", "0,8,N,1", "9600,9,N,1", "9600,8,X,1", "9600,8,N,3", "9600,8,N,1,fast", "9600,8,N,1,1s,extra"} {
+		_, err := cereal.ParseMode(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing mode %q", invalid)
+		}
+	}
+}
+
+func TestModeFlags(t *testing.T) {
+	var (
+		mode     cereal.Mode
+		parity   cereal.Parity
+		stopbits cereal.StopBits
+	)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&mode, "serial", "serial port mode")
+	fs.Var(&parity, "parity", "parity")
+	fs.Var(&stopbits, "stopbits", "stop bits")
+	err := fs.Parse([]string{"-serial", "19200,8,O,2", "-parity", "space", "-stopbits", "1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := cereal.Mode{BaudRate: 19200, DataBits: 8, Parity: cereal.ParityOdd, StopBits: cereal.StopBits2}
+	if mode != expect {
+		t.Errorf("expected mode %+v; got %+v", expect, mode)
+	}
+	if parity != cereal.ParitySpace || stopbits != cereal.StopBits1Half {
+		t.Errorf("unexpected parity %s or stop bits %s", parity, stopbits)
+	}
+	fs.SetOutput(io.Discard)
+	err = fs.Parse([]string{"-parity", "bad"})
+	if err == nil {
+		t.Error("expected error setting invalid parity flag")
+	}
+}
+
+func TestResolvePortName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks not resolved on windows")
+	}
+	dir := t.TempDir()
+	dev := filepath.Join(dir, "ttyUSB0")
+	err := os.WriteFile(dev, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "usb-FTDI_FT232R_USB_UART_A50285BI-if00-port0")
+	err = os.Symlink(dev, link)
+	if err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	got, err := cereal.ResolvePortName(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(dev)
+	if got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+}
+
+func TestSamePortName(t *testing.T) {
+	var tests = []struct {
+		a, b           string
+		windows, other bool
+	}{
+		{a: "COM3", b: "COM3", windows: true, other: true},
+		{a: "COM3", b: "com3", windows: true, other: false},
+		{a: `\\.\COM3`, b: "COM3", windows: true, other: false},
+		{a: `\\.\com10`, b: `\\.\COM10`, windows: true, other: false},
+		{a: `\\.\COM1`, b: "COM10", windows: false, other: false},
+		{a: "COM1", b: "COM2", windows: false, other: false},
+		{a: "/dev/ttyUSB0", b: "/dev/ttyUSB0", windows: true, other: true},
+		{a: "/dev/ttyUSB0", b: "/dev/ttyUSB1", windows: false, other: false},
+	}
+	for _, test := range tests {
+		want := test.other
+		if runtime.GOOS == "windows" {
+			want = test.windows
+		}
+		got := cereal.SamePortName(test.a, test.b)
+		if got != want {
+			t.Errorf("SamePortName(%q, %q): expected %v; got %v", test.a, test.b, want, got)
+		}
+		got = cereal.SamePortName(test.b, test.a)
+		if got != want {
+			t.Errorf("SamePortName(%q, %q): expected %v; got %v", test.b, test.a, want, got)
+		}
+	}
+}
+
+func TestDevicePath(t *testing.T) {
+	for i := 1; i <= 20; i++ {
+		name := fmt.Sprintf("COM%d", i)
+		got := cereal.DevicePath(name)
+		if runtime.GOOS != "windows" {
+			if got != name {
+				t.Errorf("expected %q unchanged; got %q", name, got)
+			}
+			continue
+		}
+		want := `\\.\` + name
+		if got != want {
+			t.Errorf("expected %q; got %q", want, got)
+		}
+		if again := cereal.DevicePath(got); again != want {
+			t.Errorf("expected DevicePath(%q) unchanged; got %q", want, again)
+		}
+		if !cereal.SamePortName(got, name) {
+			t.Errorf("expected %q and %q to be the same port", got, name)
+		}
+	}
+}
+
+func TestDataBitsDefault(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "nonexistent")
+	for _, o := range []cereal.Opener{cereal.Bugst{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Termios{}} {
+		// The port does not exist so opening always fails, but a DataBits of zero must reach
+		// the backend as 8 and fail the same way while invalid data bits are rejected before.
+		_, err8 := o.OpenPort(name, cereal.Mode{BaudRate: 9600, DataBits: 8})
+		_, err0 := o.OpenPort(name, cereal.Mode{BaudRate: 9600})
+		_, err9 := o.OpenPort(name, cereal.Mode{BaudRate: 9600, DataBits: 9})
+		if err8 == nil || err0 == nil || err9 == nil {
+			t.Fatalf("%v: expected errors opening nonexistent port", o)
+		}
+		if err0.Error() != err8.Error() {
+			t.Errorf("%v: expected DataBits 0 to behave as 8, got %q and %q", o, err0, err8)
+		}
+		if err9.Error() == err8.Error() {
+			t.Errorf("%v: expected invalid data bits rejected, got %q", o, err9)
+		}
+	}
+	if got := (cereal.Mode{BaudRate: 1000}).TransmitDuration(1); got != 10*time.Millisecond {
+		t.Errorf("expected default 8N1 character to take 10ms at 1000 baud, got %s", got)
+	}
+}
+
+func TestGoburrowStopBits(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "nonexistent")
+	var tests = []struct {
+		stopbits  cereal.StopBits
+		supported bool
+	}{
+		{cereal.StopBits1, true},
+		{cereal.StopBits2, true},
+		{cereal.StopBits1Half, false},
+		{cereal.StopBits(0xff), false},
+	}
+	_, errOpen := cereal.Goburrow{}.OpenPort(name, cereal.Mode{BaudRate: 9600})
+	for _, test := range tests {
+		// Supported stop bits must reach goburrow, which fails to open the nonexistent port.
+		_, err := cereal.Goburrow{}.OpenPort(name, cereal.Mode{BaudRate: 9600, StopBits: test.stopbits})
+		if reached := err != nil && err.Error() == errOpen.Error(); reached != test.supported {
+			t.Errorf("stop bits %v: expected supported=%v, got error %v", test.stopbits, test.supported, err)
+		}
+	}
+}
+
+func TestTermios(t *testing.T) {
+	if !(cereal.Termios{}).Available() {
+		t.Skip("termios backend not available")
+	}
+	// The pseudoterminal multiplexer accepts termios configuration like a serial port.
+	const ptmx = "/dev/ptmx"
+	if _, err := os.Stat(ptmx); err != nil {
+		t.Skip(err)
+	}
+	var tests = []struct {
+		mode      cereal.Mode
+		supported bool
+	}{
+		{cereal.Mode{BaudRate: 9600}, true},
+		{cereal.Mode{BaudRate: 250000, Parity: cereal.ParityMark, StopBits: cereal.StopBits2}, true},
+		{cereal.Mode{BaudRate: 9600, DataBits: 5, StopBits: cereal.StopBits1Half}, true},
+		{cereal.Mode{BaudRate: 9600, DataBits: 8, StopBits: cereal.StopBits1Half}, false},
+		{cereal.Mode{BaudRate: 9600, ReadTimeout: 100 * time.Millisecond}, true},
+		{cereal.Mode{BaudRate: 9600, ReadTimeout: 30 * time.Second}, false},
+	}
+	for _, test := range tests {
+		port, err := cereal.Termios{}.OpenPort(ptmx, test.mode)
+		if test.supported {
+			if err != nil {
+				t.Errorf("mode %+v: %v", test.mode, err)
+				continue
+			}
+			nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+			if name, ok := cereal.PortName(nb); !ok || name != ptmx {
+				t.Errorf("expected port name %q, got %q, %v", ptmx, name, ok)
+			}
+			port.Close()
+		} else if !errors.Is(err, cereal.ErrNotSupported) {
+			t.Errorf("mode %+v: expected ErrNotSupported, got %v", test.mode, err)
+		}
+	}
+}
+
+func TestSetBaudRate(t *testing.T) {
+	port := &baudPort{}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+	err := cereal.SetBaudRate(nb, 115200)
+	if err != nil || port.baud != 115200 {
+		t.Fatal("baud rate not set through NonBlocking", port.baud, err)
+	}
+	err = cereal.SetBaudRate(&readwritecloser{}, 115200)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+}
+
+type baudPort struct {
+	readwritecloser
+	baud int
+}
+
+func (bp *baudPort) SetBaudRate(baud int) error {
+	bp.baud = baud
+	return nil
+}
+
+func TestSetMode(t *testing.T) {
+	port := &modePort{}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+	mode := cereal.Mode{BaudRate: 57600, DataBits: 7, Parity: cereal.ParityOdd}
+	err := cereal.SetMode(nb, mode)
+	if err != nil || port.mode != mode {
+		t.Fatal("mode not set through NonBlocking", port.mode, err)
+	}
+	err = cereal.SetMode(&readwritecloser{}, mode)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+}
+
+type modePort struct {
+	readwritecloser
+	mode cereal.Mode
+}
+
+func (mp *modePort) SetMode(mode cereal.Mode) error {
+	mp.mode = mode
+	return nil
+}
+
+func (mp *modePort) SetParity(parity cereal.Parity) error {
+	mp.mode.Parity = parity
+	return nil
+}
+
+func (mp *modePort) SetStopBits(stopBits cereal.StopBits) error {
+	mp.mode.StopBits = stopBits
+	return nil
+}
+
+func TestSetParity(t *testing.T) {
+	port := &modePort{}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+	err := cereal.SetParity(nb, cereal.ParityEven)
+	if err != nil || port.mode.Parity != cereal.ParityEven {
+		t.Fatal("parity not set through NonBlocking", port.mode, err)
+	}
+	err = cereal.SetStopBits(nb, cereal.StopBits2)
+	if err != nil || port.mode.StopBits != cereal.StopBits2 {
+		t.Fatal("stop bits not set through NonBlocking", port.mode, err)
+	}
+	err = cereal.SetParity(&readwritecloser{}, cereal.ParityEven)
+	if !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+}
+
+func TestDetectBaud(t *testing.T) {
+	const deviceBaud = 38400
+	opened := 0
+	closed := 0
+	o := openerFunc(func(name string, mode cereal.Mode) (io.ReadWriteCloser, error) {
+		if mode.BaudRate == 1200 {
+			return nil, errors.New("unsupported baud rate")
+		}
+		opened++
+		return &baudPort{
+			readwritecloser: readwritecloser{close: func() error { closed++; return nil }},
+			baud:            mode.BaudRate,
+		}, nil
+	})
+	probe := func(port io.ReadWriteCloser) bool {
+		return port.(*baudPort).baud == deviceBaud
+	}
+	baud, err := cereal.DetectBaud(o, "/dev/ttyUSB0", []int{1200, 9600, 19200, deviceBaud, 115200}, probe)
+	if err != nil || baud != deviceBaud {
+		t.Fatal("unexpected detected baud", baud, err)
+	}
+	if opened != 3 || closed != opened {
+		t.Errorf("expected 3 opens and closes; got %d opens and %d closes", opened, closed)
+	}
+	_, err = cereal.DetectBaud(o, "/dev/ttyUSB0", []int{1200, 9600}, probe)
+	if !errors.Is(err, cereal.ErrBaudNotDetected) {
+		t.Error("expected ErrBaudNotDetected, got", err)
+	}
+}
+
+func TestMultiPort(t *testing.T) {
+	mp := cereal.NewMultiPort()
+	sent := false
+	a := cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		if sent {
+			return 0, io.EOF
+		}
+		sent = true
+		return copy(b, "hello"), nil
+	}}, cereal.NonBlockingConfig{})
+	pr, pw := io.Pipe()
+	b := cereal.NewNonBlocking(&readwritecloser{read: pr.Read, close: pr.Close}, cereal.NonBlockingConfig{})
+	if err := mp.Add("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add("b", b); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add("a", a); err == nil {
+		t.Error("expected error adding duplicate port name")
+	}
+	got := make(map[string]string)
+	var aErr error
+	timeout := time.After(5 * time.Second)
+	for len(got["a"]) < 5 || aErr == nil {
+		select {
+		case msg := <-mp.Messages():
+			if msg.Err != nil && msg.Port == "a" {
+				aErr = msg.Err
+			} else if msg.Err != nil {
+				t.Fatal("unexpected error from port", msg.Port, msg.Err)
+			}
+			got[msg.Port] += string(msg.Data)
+		case <-timeout:
+			t.Fatal("timed out waiting for port a")
+		}
+	}
+	if got["a"] != "hello" || aErr != io.EOF {
+		t.Errorf("unexpected port a result %q, %v", got["a"], aErr)
+	}
+	// Port b must keep working after port a failed.
+	go pw.Write([]byte("world"))
+	for len(got["b"]) < 5 {
+		select {
+		case msg := <-mp.Messages():
+			if msg.Port != "b" || msg.Err != nil {
+				t.Fatal("unexpected message", msg.Port, msg.Err)
+			}
+			got["b"] += string(msg.Data)
+		case <-timeout:
+			t.Fatal("timed out waiting for port b")
+		}
+	}
+	if got["b"] != "world" {
+		t.Errorf("unexpected port b data %q", got["b"])
+	}
+	if mp.Remove("b") != b {
+		t.Error("expected removed port to be returned")
+	}
+	if mp.Remove("b") != nil {
+		t.Error("expected nil removing absent port")
+	}
+	b.Close()
+	if err := mp.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-mp.Messages(); ok {
+		t.Error("expected messages channel closed")
+	}
+}
+
+func TestBusArbiter(t *testing.T) {
+	const gap = 20 * time.Millisecond
+	echo := make(chan []byte, 16)
+	var mu sync.Mutex
+	var writeTimes []time.Time
+	port := &readwritecloser{
+		read: func(b []byte) (int, error) {
+			return copy(b, <-echo), nil
+		},
+		write: func(b []byte) (int, error) {
+			mu.Lock()
+			writeTimes = append(writeTimes, time.Now())
+			mu.Unlock()
+			echo <- append([]byte(nil), b...)
+			return len(b), nil
+		},
+	}
+	ba := cereal.NewBusArbiter(cereal.NewNonBlocking(port, cereal.NonBlockingConfig{}), gap)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := fmt.Sprintf("request %d", i)
+			resp, err := ba.Transact([]byte(req), time.Second)
+			if err != nil {
+				t.Error(err)
+			} else if string(resp) != req {
+				t.Errorf("expected response %q; got %q", req, resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(writeTimes); i++ {
+		if d := writeTimes[i].Sub(writeTimes[i-1]); d < gap {
+			t.Errorf("transactions %d and %d separated by %s, expected at least %s", i-1, i, d, gap)
+		}
+	}
+	// No response.
+	silent := cereal.NewBusArbiter(cereal.NewNonBlocking(&readwritecloser{read: func(b []byte) (int, error) {
+		time.Sleep(time.Millisecond)
+		return 0, nil
+	}}, cereal.NonBlockingConfig{}), gap)
+	_, err := silent.Transact([]byte("ping"), 50*time.Millisecond)
+	if err == nil {
+		t.Error("expected error on transaction without response")
+	}
+}
+
+func TestCRC(t *testing.T) {
+	check := []byte("123456789")
+	if got := cereal.Crc16Modbus(check); got != 0x4B37 {
+		t.Errorf("Crc16Modbus: expected 0x4B37; got %#04x", got)
+	}
+	if got := cereal.Crc16CCITT(check); got != 0x29B1 {
+		t.Errorf("Crc16CCITT: expected 0x29B1; got %#04x", got)
+	}
+	if got := cereal.Crc8Dallas(check); got != 0xA1 {
+		t.Errorf("Crc8Dallas: expected 0xA1; got %#02x", got)
+	}
+}
+
+func TestChecksumFramer(t *testing.T) {
+	const idle = 20 * time.Millisecond
+	nb := cereal.NewNonBlocking(newLoopback(), cereal.NonBlockingConfig{})
+	cf := cereal.NewChecksumFramer(nb, cereal.ChecksumModbus, idle)
+	// Modbus read holding registers request with its well known CRC.
+	err := cf.WriteFrame([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cf.ReadFrame(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}) {
+		t.Errorf("unexpected frame %x", frame)
+	}
+	// Corrupted frame is consumed and followed by a good frame.
+	nb.Write([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCE})
+	_, err = cf.ReadFrame(time.Now().Add(time.Second))
+	if err != cereal.ErrBadChecksum {
+		t.Fatal("expected ErrBadChecksum, got", err)
+	}
+	cf.WriteFrame([]byte("good"))
+	frame, err = cf.ReadFrame(time.Now().Add(time.Second))
+	if err != nil || string(frame) != "good" {
+		t.Fatalf("expected resync to good frame, got %q, %v", frame, err)
+	}
+}
+
+func TestNMEAReader(t *testing.T) {
+	const sentence = "$GPGLL,4916.45,N,12311.12,W,225444,A*31"
+	port := newLoopback()
+	nr := cereal.NewNMEAReader(port)
+	// Cold start mid-sentence, a good sentence, a bad checksum and an interrupted sentence.
+	port.Write([]byte("44,A*31\r\n" + sentence + "\r\n"))
+	port.Write([]byte("$GPGLL,4916.45,N,12311.12,W,225444,A*32\r\n$GPGLL,49" + sentence + "\r\n"))
+	deadline := time.Now().Add(time.Second)
+	got, err := nr.ReadSentence(deadline)
+	if err != nil || got != sentence {
+		t.Fatalf("expected %q; got %q, %v", sentence, got, err)
+	}
+	_, err = nr.ReadSentence(deadline)
+	if err != cereal.ErrBadChecksum {
+		t.Fatal("expected ErrBadChecksum, got", err)
+	}
+	got, err = nr.ReadSentence(deadline)
+	if err != nil || got != sentence {
+		t.Fatalf("expected %q; got %q, %v", sentence, got, err)
+	}
+	_, err = nr.ReadSentence(time.Now().Add(10 * time.Millisecond))
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	const sentence = "$GPGLL,4916.45,N,12311.12,W,225444,A*31"
+	port := newLoopback()
+	nr := cereal.NewNMEAReader(port)
+	nr.SetMaxFrameSize(82)
+	port.Write([]byte("$" + strings.Repeat("A", 200)))
+	_, err := nr.ReadSentence(time.Now().Add(time.Second))
+	if err != cereal.ErrFrameTooLarge {
+		t.Fatal("expected ErrFrameTooLarge, got", err)
+	}
+	port.Write([]byte("AAAA\r\n" + sentence + "\r\n"))
+	got, err := nr.ReadSentence(time.Now().Add(time.Second))
+	if err != nil || got != sentence {
+		t.Fatalf("expected resync to %q; got %q, %v", sentence, got, err)
+	}
+
+	nb := cereal.NewNonBlocking(newLoopback(), cereal.NonBlockingConfig{})
+	cf := cereal.NewChecksumFramer(nb, cereal.ChecksumDallas, 20*time.Millisecond)
+	cf.SetMaxFrameSize(8)
+	cf.WriteFrame([]byte("too large a frame"))
+	_, err = cf.ReadFrame(time.Now().Add(time.Second))
+	if err != cereal.ErrFrameTooLarge {
+		t.Fatal("expected ErrFrameTooLarge, got", err)
+	}
+	cf.WriteFrame([]byte("fits"))
+	frame, err := cf.ReadFrame(time.Now().Add(time.Second))
+	if err != nil || string(frame) != "fits" {
+		t.Fatalf("expected resync to %q; got %q, %v", "fits", frame, err)
+	}
+}
+
+func TestLengthPrefixedFramer(t *testing.T) {
+	for _, test := range []struct {
+		size   int
+		order  binary.ByteOrder
+		prefix []byte
+	}{
+		{1, nil, []byte{5}},
+		{2, binary.BigEndian, []byte{0, 5}},
+		{4, binary.LittleEndian, []byte{5, 0, 0, 0}},
+	} {
+		port := newLoopback()
+		lf := cereal.NewLengthPrefixedFramer(port, test.size, test.order)
+		port.Write(append(test.prefix[:len(test.prefix):len(test.prefix)], "hel"...))
+		_, err := lf.ReadMessage(time.Now().Add(20 * time.Millisecond))
+		if err == nil {
+			t.Fatalf("size %d: expected timeout on partial message", test.size)
+		}
+		// The partial message is completed by the next read and the following message stays buffered.
+		port.Write([]byte("lo"))
+		lf.WriteMessage([]byte("world!"))
+		for _, want := range []string{"hello", "world!"} {
+			got, err := lf.ReadMessage(time.Now().Add(time.Second))
+			if err != nil || string(got) != want {
+				t.Errorf("size %d: expected %q, got %q, %v", test.size, want, got, err)
+			}
+		}
+	}
+
+	port := newLoopback()
+	lf := cereal.NewLengthPrefixedFramer(port, 2, binary.BigEndian)
+	if err := lf.WriteMessage(make([]byte, 1<<16)); err != cereal.ErrFrameTooLarge {
+		t.Error("expected ErrFrameTooLarge writing message longer than prefix allows, got", err)
+	}
+	lf.SetMaxFrameSize(4)
+	lf.WriteMessage([]byte("too large"))
+	lf.WriteMessage([]byte("fits"))
+	_, err := lf.ReadMessage(time.Now().Add(time.Second))
+	if err != cereal.ErrFrameTooLarge {
+		t.Fatal("expected ErrFrameTooLarge, got", err)
+	}
+	got, err := lf.ReadMessage(time.Now().Add(time.Second))
+	if err != nil || string(got) != "fits" {
+		t.Errorf("expected resync to %q, got %q, %v", "fits", got, err)
+	}
+}
+
+func TestCobsFramer(t *testing.T) {
+	port := newLoopback()
+	cf := cereal.NewCobsFramer(port)
+	long := bytes.Repeat([]byte{1, 2, 3}, 200)
+	frames := [][]byte{{}, {0}, []byte("hello\x00world"), long, append(long, 0)}
+	for _, frame := range frames {
+		if err := cf.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range frames {
+		got, err := cf.ReadFrame(time.Now().Add(time.Second))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("expected %q, got %q, %v", want, got, err)
+		}
+	}
+	// Consecutive delimiters, as sent to resynchronize, do not produce frames.
+	port.Write([]byte{0, 0, 5, 'a', 0})
+	if _, err := cf.ReadFrame(time.Now().Add(time.Second)); err != cereal.ErrBadEncoding {
+		t.Fatal("expected ErrBadEncoding, got", err)
+	}
+	cf.SetMaxFrameSize(4)
+	cf.WriteFrame([]byte("too large"))
+	cf.WriteFrame([]byte("fits"))
+	if _, err := cf.ReadFrame(time.Now().Add(time.Second)); err != cereal.ErrFrameTooLarge {
+		t.Fatal("expected ErrFrameTooLarge, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := cf.Frames(ctx)
+	cf.WriteFrame([]byte("next"))
+	got := <-ch
+	if got.Err != nil || string(got.Frame) != "fits" {
+		t.Fatalf("expected %q, got %q, %v", "fits", got.Frame, got.Err)
+	}
+	// The goroutine must exit on cancel even though the frame it read is never received.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case _, ok := <-ch:
+		for ok {
+			_, ok = <-ch
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+
+	cf.Close()
+	ch = cf.Frames(context.Background())
+	var last cereal.FrameOrErr
+	for f := range ch {
+		last = f
+	}
+	if last.Err == nil {
+		t.Fatal("expected terminal error after Close")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	// HDLC byte stuffing.
+	enc := cereal.NewEscapeEncoder(0x7e, 0x7d, 0x20)
+	dec := cereal.NewEscapeDecoder(0x7e, 0x7d, 0x20)
+	frame := []byte{1, 0x7e, 2, 0x7d, 0x5e, 3}
+	encoded := enc.AppendFrame(nil, frame)
+	want := []byte{1, 0x7d, 0x5e, 2, 0x7d, 0x5d, 0x5e, 3, 0x7e}
+	if !bytes.Equal(encoded, want) {
+		t.Fatalf("expected encoding %x, got %x", want, encoded)
+	}
+	got, err := dec.Decode(nil, encoded[:len(encoded)-1])
+	if err != nil || !bytes.Equal(got, frame) {
+		t.Fatalf("expected to decode %x, got %x, %v", frame, got, err)
+	}
+	got, err = dec.Decode([]byte("keep"), []byte{1, 0x7d})
+	if err != cereal.ErrDanglingEscape || !errors.Is(err, cereal.ErrBadEncoding) || string(got) != "keep" {
+		t.Errorf("expected ErrDanglingEscape with dst unmodified, got %q, %v", got, err)
+	}
+	if _, err = dec.Decode(nil, []byte{1, 0x7e, 2}); !errors.Is(err, cereal.ErrBadEncoding) {
+		t.Error("expected ErrBadEncoding on unescaped delimiter, got", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on ambiguous escape parameters")
+		}
+	}()
+	cereal.NewEscapeEncoder(0x7e, 0x7d, 0x7e^0x7d)
+}
+
+func TestMonitor(t *testing.T) {
+	host, device := cereal.Pipe()
+	defer device.Close()
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- cereal.Monitor(ctx, host, inr, outw) }()
+
+	device.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err := io.ReadFull(outr, buf)
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("expected device data copied to out, got %q, %v", buf, err)
+	}
+	inw.Write([]byte("cmd"))
+	buf = buf[:3]
+	_, err = io.ReadFull(device, buf)
+	if err != nil || string(buf) != "cmd" {
+		t.Fatalf("expected input copied to device, got %q, %v", buf, err)
+	}
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Error("expected context.Canceled, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Monitor did not return after cancel")
+	}
+	inw.Close()
+}
+
+func TestPipe(t *testing.T) {
+	a, b := cereal.Pipe()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		// Fake device echoing requests in uppercase.
+		defer wg.Done()
+		var buf [64]byte
+		for {
+			n, err := b.Read(buf[:])
+			if err != nil {
+				if err != io.EOF {
+					t.Error(err)
+				}
+				return
+			}
+			b.Write(bytes.ToUpper(buf[:n]))
+		}
+	}()
+	client := cereal.NewNonBlocking(a, cereal.NonBlockingConfig{})
+	for _, req := range []string{"hello\n", "world\n"} {
+		resp, err := client.Transact([]byte(req), '\n', time.Second)
+		if err != nil || string(resp) != strings.ToUpper(req) {
+			t.Fatalf("expected %q; got %q, %v", strings.ToUpper(req), resp, err)
+		}
+	}
+	client.Close()
+	wg.Wait() // Device end must see io.EOF after the client closes.
+	_, err := b.Write([]byte("late"))
+	if err != io.ErrClosedPipe {
+		t.Error("expected io.ErrClosedPipe writing to closed pipe, got", err)
+	}
+}
+
+func TestPipeConditions(t *testing.T) {
+	const byteDelay = time.Millisecond
+	a, b := cereal.NewPipe(cereal.PipeConfig{ByteDelay: byteDelay})
+	data := []byte("twenty bytes of data")
+	start := time.Now()
+	a.Write(data)
+	got := make([]byte, len(data))
+	_, err := io.ReadFull(b, got)
+	if elapsed := time.Since(start); err != nil || elapsed < time.Duration(len(data))*byteDelay {
+		t.Errorf("expected %d bytes to take at least %s, took %s, %v", len(data), time.Duration(len(data))*byteDelay, elapsed, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %q; got %q", data, got)
+	}
+
+	// transfer writes 1000 zero bytes and returns what is received once the writer closes.
+	transfer := func(cfg cereal.PipeConfig) []byte {
+		a, b := cereal.NewPipe(cfg)
+		a.Write(make([]byte, 1000))
+		a.Close()
+		got, err := io.ReadAll(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	cfg := cereal.PipeConfig{BitErrorRate: 0.01, Seed: 1}
+	corrupted := transfer(cfg)
+	flipped := 0
+	for _, c := range corrupted {
+		for ; c != 0; c &= c - 1 {
+			flipped++
+		}
+	}
+	if len(corrupted) != 1000 || flipped < 20 || flipped > 200 {
+		t.Errorf("expected about 80 bits flipped in 1000 bytes, got %d in %d bytes", flipped, len(corrupted))
+	}
+	if !bytes.Equal(corrupted, transfer(cfg)) {
+		t.Error("expected same seed to corrupt identically")
+	}
+	dropped := 1000 - len(transfer(cereal.PipeConfig{DropRate: 0.1, Seed: 1}))
+	if dropped < 50 || dropped > 150 {
+		t.Errorf("expected about 100 of 1000 bytes dropped, got %d", dropped)
+	}
+}
+
+// newLoopback returns a port which reads back the data written to it.
+func newLoopback() *readwritecloser {
+	data := make(chan []byte, 64)
+	return &readwritecloser{
+		read: func(b []byte) (int, error) {
+			return copy(b, <-data), nil
+		},
+		write: func(b []byte) (int, error) {
+			data <- append([]byte(nil), b...)
+			return len(b), nil
+		},
+	}
+}
+
 type nop struct {
 	io.ReadWriter
 	io.Closer
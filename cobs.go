@@ -0,0 +1,169 @@
+package cereal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrBadEncoding is returned when a received frame is not validly encoded.
+// The bad frame has been consumed so the next read starts at the following frame.
+var ErrBadEncoding = errors.New("bad frame encoding")
+
+// CobsFramer writes and reads frames encoded with Consistent Overhead Byte Stuffing (COBS).
+// COBS removes all zero bytes from the frame so that a zero byte unambiguously delimits frames.
+// Unlike [ChecksumFramer] frames are told apart regardless of timing and a receiver joining
+// mid-stream synchronizes at the next delimiter.
+type CobsFramer struct {
+	nb       *NonBlocking
+	maxFrame int
+	// pending holds received bytes not yet decoded into a frame.
+	pending []byte
+	// skip is set while discarding an oversized frame up to its delimiter.
+	skip bool
+}
+
+// FrameOrErr is a frame or an error received by [CobsFramer.Frames].
+type FrameOrErr struct {
+	Frame []byte
+	Err   error
+}
+
+// NewCobsFramer returns a CobsFramer reading and writing frames over rwc.
+// If rwc is not a [NonBlocking] it is wrapped in one so that reads can time out.
+func NewCobsFramer(rwc io.ReadWriteCloser) *CobsFramer {
+	nb, ok := rwc.(*NonBlocking)
+	if !ok {
+		nb = NewNonBlocking(rwc, NonBlockingConfig{})
+	}
+	return &CobsFramer{nb: nb}
+}
+
+// SetMaxFrameSize limits the size of received frames, after decoding, to n bytes.
+// Larger frames are discarded as they are received and [ErrFrameTooLarge] is returned once
+// their delimiter arrives. A value of zero, the default, sets no limit.
+func (cf *CobsFramer) SetMaxFrameSize(n int) {
+	if n < 0 {
+		panic("invalid max frame size")
+	}
+	cf.maxFrame = n
+}
+
+// WriteFrame writes b encoded followed by the zero delimiter.
+func (cf *CobsFramer) WriteFrame(b []byte) error {
+	frame := cobsEncode(make([]byte, 0, len(b)+len(b)/254+2), b)
+	_, err := cf.nb.WriteFrame(append(frame, 0))
+	return err
+}
+
+// ReadFrame reads the next frame received before the deadline and returns it decoded.
+// If the deadline passes mid-frame the bytes received so far are kept and the frame is
+// completed by the next call. Consecutive delimiters are skipped and do not produce empty frames.
+// A frame that is not validly encoded is discarded and [ErrBadEncoding] is returned.
+func (cf *CobsFramer) ReadFrame(deadline time.Time) ([]byte, error) {
+	var buf [256]byte
+	for {
+		if i := bytes.IndexByte(cf.pending, 0); i >= 0 {
+			skip := cf.skip
+			cf.skip = false
+			var frame []byte
+			var err error
+			if !skip && i > 0 {
+				frame, err = cobsDecode(cf.pending[:i])
+			}
+			cf.pending = cf.pending[:copy(cf.pending, cf.pending[i+1:])]
+			switch {
+			case skip || (err == nil && cf.maxFrame > 0 && len(frame) > cf.maxFrame):
+				return nil, ErrFrameTooLarge
+			case err != nil:
+				return nil, err
+			case i > 0:
+				return frame, nil
+			}
+			continue
+		}
+		if cf.maxFrame > 0 && len(cf.pending) > cf.maxFrame+cf.maxFrame/254+1 {
+			// Longer than any encoding of a frame of maxFrame bytes.
+			cf.skip = true
+			cf.pending = cf.pending[:0]
+		}
+		n, err := cf.nb.readNext(buf[:], deadline)
+		if err != nil {
+			return nil, err
+		}
+		cf.pending = append(cf.pending, buf[:n]...)
+	}
+}
+
+// Frames starts a goroutine that reads frames and sends them on the returned channel
+// until ctx is canceled or reading fails with an error other than [ErrBadEncoding] or
+// [ErrFrameTooLarge], which is sent before the channel is closed. The goroutine exits
+// without blocking on the channel when ctx is canceled so the channel need not be drained.
+// ReadFrame must not be called while the goroutine is running.
+func (cf *CobsFramer) Frames(ctx context.Context) <-chan FrameOrErr {
+	frames := make(chan FrameOrErr)
+	go func() {
+		defer close(frames)
+		for ctx.Err() == nil {
+			// Read with a short deadline to notice cancellation.
+			frame, err := cf.ReadFrame(time.Now().Add(100 * time.Millisecond))
+			if err == errDeadlineExceeded {
+				continue
+			}
+			select {
+			case frames <- FrameOrErr{Frame: frame, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil && err != ErrBadEncoding && err != ErrFrameTooLarge {
+				return
+			}
+		}
+	}()
+	return frames
+}
+
+// Close closes the underlying port.
+func (cf *CobsFramer) Close() error {
+	return cf.nb.Close()
+}
+
+// cobsEncode appends the COBS encoding of src to dst, without delimiter.
+func cobsEncode(dst, src []byte) []byte {
+	codeIdx := len(dst)
+	dst = append(dst, 0)
+	code := byte(1)
+	for _, c := range src {
+		if c != 0 {
+			dst = append(dst, c)
+			code++
+		}
+		if c == 0 || code == 0xff {
+			dst[codeIdx] = code
+			codeIdx = len(dst)
+			dst = append(dst, 0)
+			code = 1
+		}
+	}
+	dst[codeIdx] = code
+	return dst
+}
+
+// cobsDecode decodes a COBS encoded frame without delimiter.
+func cobsDecode(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src))
+	for i := 0; i < len(src); {
+		code := int(src[i])
+		if code == 0 || i+code > len(src) {
+			return nil, ErrBadEncoding
+		}
+		dst = append(dst, src[i+1:i+code]...)
+		i += code
+		if code < 0xff && i < len(src) {
+			dst = append(dst, 0)
+		}
+	}
+	return dst, nil
+}
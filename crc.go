@@ -0,0 +1,52 @@
+package cereal
+
+// Crc16Modbus returns the CRC-16/MODBUS checksum of data: reflected polynomial 0x8005
+// (0xA001 reversed) with initial value 0xFFFF. Modbus RTU transmits it low byte first.
+func Crc16Modbus(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Crc16CCITT returns the CRC-16/CCITT-FALSE checksum of data: polynomial 0x1021
+// with initial value 0xFFFF, not reflected. It is usually transmitted high byte first.
+func Crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Crc8Dallas returns the Dallas/Maxim 1-Wire CRC-8 checksum of data: reflected
+// polynomial 0x31 (0x8C reversed) with initial value 0.
+func Crc8Dallas(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
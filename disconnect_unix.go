@@ -0,0 +1,13 @@
+//go:build !windows
+
+package cereal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDisconnectErr reports whether err indicates the device backing a port is gone.
+func isDisconnectErr(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO)
+}
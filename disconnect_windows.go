@@ -0,0 +1,21 @@
+//go:build windows
+
+package cereal
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorBadCommand         syscall.Errno = 22
+	errorGenFailure         syscall.Errno = 31
+	errorDeviceNotConnected syscall.Errno = 1167
+)
+
+// isDisconnectErr reports whether err indicates the device backing a port is gone.
+func isDisconnectErr(err error) bool {
+	// ERROR_OPERATION_ABORTED is not included since closing the port aborts the read in progress with it.
+	return errors.Is(err, errorDeviceNotConnected) || errors.Is(err, errorGenFailure) ||
+		errors.Is(err, errorBadCommand)
+}
@@ -0,0 +1,84 @@
+package cereal
+
+import "fmt"
+
+// ErrDanglingEscape is returned when a frame ends with an escape byte that is not followed
+// by the escaped byte, i.e. due to bytes lost on the line. It wraps [ErrBadEncoding]: the frame is
+// discarded and decoding resynchronizes at the next delimiter.
+var ErrDanglingEscape = fmt.Errorf("%w: dangling escape byte", ErrBadEncoding)
+
+// EscapeEncoder encodes frames delimited by a delimiter byte using byte stuffing: occurrences
+// of the delimiter and escape bytes in the frame are replaced by the escape byte followed by
+// the original byte XORed with a mask. This is the framing of HDLC and PPP, which use
+// a 0x7E delimiter, 0x7D escape and 0x20 mask. Use [EscapeDecoder] with the same parameters to decode.
+type EscapeEncoder struct {
+	delim, esc, mask byte
+}
+
+// NewEscapeEncoder returns an EscapeEncoder with the given delimiter, escape byte and XOR mask.
+// It panics if the parameters are ambiguous, i.e. if an escaped byte is a delimiter or escape byte.
+func NewEscapeEncoder(delim, escape, mask byte) EscapeEncoder {
+	checkEscape(delim, escape, mask)
+	return EscapeEncoder{delim: delim, esc: escape, mask: mask}
+}
+
+// AppendFrame appends the escaped frame followed by the delimiter to dst.
+func (e EscapeEncoder) AppendFrame(dst, frame []byte) []byte {
+	for _, c := range frame {
+		if c == e.delim || c == e.esc {
+			dst = append(dst, e.esc, c^e.mask)
+		} else {
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, e.delim)
+}
+
+// EscapeDecoder decodes frames encoded by an [EscapeEncoder].
+type EscapeDecoder struct {
+	delim, esc, mask byte
+}
+
+// NewEscapeDecoder returns an EscapeDecoder with the given delimiter, escape byte and XOR mask.
+// It panics if the parameters are ambiguous, see [NewEscapeEncoder].
+func NewEscapeDecoder(delim, escape, mask byte) EscapeDecoder {
+	checkEscape(delim, escape, mask)
+	return EscapeDecoder{delim: delim, esc: escape, mask: mask}
+}
+
+// Delimiter returns the byte that delimits frames. Received data should be split at
+// the delimiter and each frame, without the delimiter, passed to Decode.
+func (d EscapeDecoder) Delimiter() byte { return d.delim }
+
+// Decode appends the unescaped frame to dst. frame must not include the delimiter.
+// [ErrDanglingEscape] is returned if frame ends with an escape byte and an error wrapping
+// [ErrBadEncoding] if frame contains a delimiter. On error dst is returned unmodified.
+func (d EscapeDecoder) Decode(dst, frame []byte) ([]byte, error) {
+	n := len(dst)
+	for i := 0; i < len(frame); i++ {
+		c := frame[i]
+		switch c {
+		case d.delim:
+			return dst[:n], fmt.Errorf("%w: unescaped delimiter in frame", ErrBadEncoding)
+		case d.esc:
+			i++
+			if i == len(frame) {
+				return dst[:n], ErrDanglingEscape
+			}
+			c = frame[i] ^ d.mask
+		}
+		dst = append(dst, c)
+	}
+	return dst, nil
+}
+
+func checkEscape(delim, escape, mask byte) {
+	if delim == escape {
+		panic("invalid escape parameters")
+	}
+	for _, escaped := range [...]byte{delim ^ mask, escape ^ mask} {
+		if escaped == delim || escaped == escape {
+			panic("invalid escape parameters")
+		}
+	}
+}
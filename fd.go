@@ -0,0 +1,91 @@
+package cereal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errNoFileDescriptor = fmt.Errorf("%w: file descriptor not available for port", ErrNotSupported)
+
+// FileDescriptor returns the OS file descriptor (or handle on Windows) of port for use with
+// platform specific calls this package does not provide, such as ioctls.
+// Ports returned by the [Termios] Opener, by the [Sers] Opener outside Windows and ports implementing
+// `Fd() uintptr`, such as *os.File, are supported, also when wrapped by this package's types such as [NonBlocking].
+//
+// The other backends don't expose their descriptor. Their Openers open a second descriptor to the device
+// along the backend's port only when the Mode requires one, that is with [Mode.Exclusive] or
+// [Mode.NoResetOnOpen] outside Windows, and return that descriptor. Terminal settings and ioctls apply to
+// the device so they affect the backend's port too. Other ports return an error wrapping [ErrNotSupported].
+//
+// The descriptor remains owned by port and is invalid after port is closed.
+// Note that calling Fd on an *os.File puts the file in blocking mode.
+func FileDescriptor(port io.ReadWriteCloser) (uintptr, error) {
+	return fileDescriptor(port)
+}
+
+// fileDescriptor returns the OS file descriptor (or handle on Windows) of port. It walks the wrappers
+// of port, returning the descriptor of the first one implementing `Fd() uintptr`, such as *os.File
+// and Termios ports, or recorded by the Openers in a devicePort.
+// Note that calling Fd on an *os.File puts the file in blocking mode.
+func fileDescriptor(port io.ReadWriteCloser) (uintptr, error) {
+	for {
+		switch p := port.(type) {
+		case interface{ Fd() uintptr }:
+			return p.Fd(), nil
+		case *devicePort:
+			return uintptr(p.fd), nil
+		}
+		u, ok := port.(underlyingPort)
+		if !ok {
+			return 0, errNoFileDescriptor
+		}
+		port = u.Underlying()
+	}
+}
+
+// devicePort records a descriptor to the device of a backend's port that the backend does not expose.
+// It is either the backend's own descriptor, known when the Opener creates the port, or a companion
+// descriptor opened with openDevice, which is closed after the port.
+type devicePort struct {
+	io.ReadWriteCloser
+	fd        int
+	companion bool
+	once      sync.Once
+}
+
+func (dp *devicePort) Underlying() io.ReadWriteCloser { return dp.ReadWriteCloser }
+
+func (dp *devicePort) Close() error {
+	err := dp.ReadWriteCloser.Close()
+	if dp.companion {
+		dp.once.Do(func() {
+			if cerr := closeDevice(dp.fd); err == nil {
+				err = cerr
+			}
+		})
+	}
+	return err
+}
+
+// withDevice wraps port in a devicePort recording the companion descriptor fd opened with openDevice.
+// port is returned unchanged if fd is -1.
+func withDevice(port io.ReadWriteCloser, fd int) io.ReadWriteCloser {
+	if fd < 0 {
+		return port
+	}
+	return &devicePort{ReadWriteCloser: port, fd: fd, companion: true}
+}
+
+// openDeviceIf opens a companion descriptor to the device portname with openDevice if need is set.
+// Otherwise it returns -1.
+func openDeviceIf(need bool, portname string) (int, error) {
+	if !need {
+		return -1, nil
+	}
+	fd, err := openDevice(portname)
+	if err != nil {
+		return -1, openError(err)
+	}
+	return fd, nil
+}
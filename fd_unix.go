@@ -0,0 +1,26 @@
+//go:build !windows
+
+package cereal
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDevice opens a companion descriptor to the serial device portname for backends that don't expose
+// theirs, see devicePort. It must be called before the backend opens the port, which may lock it with
+// TIOCEXCL. O_NONBLOCK prevents open from blocking until carrier detect is asserted.
+func openDevice(portname string) (int, error) {
+	fd, err := syscall.Open(portname, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: portname, Err: err}
+	}
+	return fd, nil
+}
+
+func closeDevice(fd int) error {
+	if fd < 0 {
+		return nil
+	}
+	return syscall.Close(fd)
+}
@@ -0,0 +1,132 @@
+package cereal
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// ErrBadChecksum is returned when a received frame's checksum does not match its contents.
+// The bad frame has been consumed so the next read starts at the following frame.
+var ErrBadChecksum = errors.New("bad checksum")
+
+// ErrFrameTooLarge is returned when a received frame exceeds the configured maximum frame size.
+// The oversized frame is discarded so the next read starts at the following frame.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Checksum describes a checksum appended to frames by a [ChecksumFramer].
+type Checksum struct {
+	// Size is the length in bytes of the checksum.
+	Size int
+	// Append appends the checksum of data to dst in the byte order it is transmitted.
+	Append func(dst, data []byte) []byte
+}
+
+var (
+	// ChecksumModbus is a [Crc16Modbus] checksum transmitted low byte first, as used by Modbus RTU.
+	ChecksumModbus = Checksum{Size: 2, Append: func(dst, data []byte) []byte {
+		crc := Crc16Modbus(data)
+		return append(dst, byte(crc), byte(crc>>8))
+	}}
+	// ChecksumCCITT is a [Crc16CCITT] checksum transmitted high byte first.
+	ChecksumCCITT = Checksum{Size: 2, Append: func(dst, data []byte) []byte {
+		crc := Crc16CCITT(data)
+		return append(dst, byte(crc>>8), byte(crc))
+	}}
+	// ChecksumDallas is a [Crc8Dallas] checksum.
+	ChecksumDallas = Checksum{Size: 1, Append: func(dst, data []byte) []byte {
+		return append(dst, Crc8Dallas(data))
+	}}
+)
+
+// ChecksumFramer writes and reads frames with a trailing checksum over a [NonBlocking].
+// Frames are delimited by silence on the line: a frame is complete once no data has been
+// received for the idle duration, as is done in Modbus RTU. Since frames are told apart by
+// timing, ReadFrame should be waiting for a frame when it arrives: frames that pile up in
+// the NonBlocking buffer while no one is reading are read back as a single frame.
+type ChecksumFramer struct {
+	nb       *NonBlocking
+	sum      Checksum
+	idle     time.Duration
+	maxFrame int
+}
+
+// NewChecksumFramer returns a ChecksumFramer using the checksum sum over nb. idle is the
+// silence after which a frame is considered complete and must be greater than zero.
+func NewChecksumFramer(nb *NonBlocking, sum Checksum, idle time.Duration) *ChecksumFramer {
+	if nb == nil {
+		panic("nil NonBlocking passed into NewChecksumFramer")
+	} else if sum.Size <= 0 || sum.Append == nil {
+		panic("invalid checksum")
+	} else if idle <= 0 {
+		panic("invalid idle duration")
+	}
+	return &ChecksumFramer{nb: nb, sum: sum, idle: idle}
+}
+
+// SetMaxFrameSize limits the size of received frames, including the checksum, to n bytes.
+// Larger frames are discarded as they are received and [ErrFrameTooLarge] is returned.
+// This bounds the memory used when a device sends garbage without pause.
+// A value of zero, the default, sets no limit.
+func (cf *ChecksumFramer) SetMaxFrameSize(n int) {
+	if n < 0 {
+		panic("invalid max frame size")
+	}
+	cf.maxFrame = n
+}
+
+// WriteFrame writes b followed by its checksum.
+func (cf *ChecksumFramer) WriteFrame(b []byte) error {
+	frame := make([]byte, 0, len(b)+cf.sum.Size)
+	frame = cf.sum.Append(append(frame, b...), b)
+	_, err := cf.nb.WriteFrame(frame)
+	return err
+}
+
+// ReadFrame waits until the deadline for the start of a frame and reads it until the line is idle.
+// It returns the frame's payload with the checksum removed. If the checksum does not match
+// the frame is discarded and [ErrBadChecksum] is returned.
+func (cf *ChecksumFramer) ReadFrame(deadline time.Time) ([]byte, error) {
+	var buf [256]byte
+	n, err := cf.nb.readNext(buf[:], deadline)
+	if err != nil {
+		return nil, err
+	}
+	frame := &frameWriter{max: cf.maxFrame}
+	frame.Write(buf[:n])
+	_, err = CopyUntilIdle(frame, cf.nb, cf.idle)
+	if err != nil {
+		return nil, err
+	} else if frame.tooLarge {
+		return nil, ErrFrameTooLarge
+	}
+	b := frame.buf.Bytes()
+	if len(b) < cf.sum.Size {
+		return nil, ErrBadChecksum
+	}
+	payload, got := b[:len(b)-cf.sum.Size], b[len(b)-cf.sum.Size:]
+	want := cf.sum.Append(buf[:0], payload)
+	if !bytes.Equal(got, want) {
+		return nil, ErrBadChecksum
+	}
+	return payload, nil
+}
+
+// frameWriter accumulates a frame up to max bytes. Data beyond max is discarded
+// and tooLarge is set. A max of zero sets no limit.
+type frameWriter struct {
+	buf      bytes.Buffer
+	max      int
+	tooLarge bool
+}
+
+func (fw *frameWriter) Write(b []byte) (int, error) {
+	if fw.max > 0 && fw.buf.Len()+len(b) > fw.max {
+		fw.tooLarge = true
+		fw.buf.Reset()
+	}
+	if !fw.tooLarge {
+		fw.buf.Write(b)
+	}
+	return len(b), nil
+}
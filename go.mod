@@ -7,9 +7,7 @@ require (
 	github.com/goburrow/serial v0.1.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 	go.bug.st/serial v1.6.1
+	golang.org/x/sys v0.14.0
 )
 
-require (
-	github.com/creack/goselect v0.1.2 // indirect
-	golang.org/x/sys v0.14.0 // indirect
-)
+require github.com/creack/goselect v0.1.2 // indirect
@@ -0,0 +1,109 @@
+package cereal
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// HalfDuplexConfig configures a [HalfDuplex].
+type HalfDuplexConfig struct {
+	// Mode is the mode the port was opened with. It is used to calculate how long
+	// written bytes take to be transmitted over the wire.
+	Mode Mode
+	// GuardTime is the extra time waited after the last byte has been transmitted before
+	// switching back to receive. Useful for slow transceivers.
+	GuardTime time.Duration
+	// SetDirection sets the transceiver direction, tx is true for transmit and false for receive.
+	// If nil the port's RTS line is used, or DTR if UseDTR is set. The port must then implement
+	// `SetRTS(bool) error` or `SetDTR(bool) error`, as the bugst ports do.
+	SetDirection func(tx bool) error
+	// UseDTR selects the DTR line to toggle instead of RTS when SetDirection is nil.
+	UseDTR bool
+}
+
+// HalfDuplex wraps a port connected to a half-duplex transceiver, such as an RS-485 transceiver
+// with a driver-enable (DE/RE) line. It asserts the transmit direction before each Write and
+// switches back to receive once the written bytes have cleared the wire.
+//
+// Writes are serialized so that concurrent writers do not switch the direction
+// while another write is being transmitted.
+type HalfDuplex struct {
+	rwc          io.ReadWriteCloser
+	mode         Mode
+	guard        time.Duration
+	setDirection func(tx bool) error
+	mu           sync.Mutex
+}
+
+// NewHalfDuplex returns a HalfDuplex wrapping rwc. It sets the direction to receive before returning.
+// If cfg.SetDirection is nil and rwc does not support toggling the selected modem line
+// [ErrNotSupported] is returned.
+func NewHalfDuplex(rwc io.ReadWriteCloser, cfg HalfDuplexConfig) (*HalfDuplex, error) {
+	if rwc == nil {
+		panic("nil ReadWriteCloser passed into NewHalfDuplex")
+	}
+	if cfg.GuardTime < 0 {
+		panic("invalid argument to NewHalfDuplex")
+	}
+	setDirection := cfg.SetDirection
+	if setDirection == nil {
+		type rtsSetter interface {
+			SetRTS(bool) error
+		}
+		type dtrSetter interface {
+			SetDTR(bool) error
+		}
+		port := unwrapPort(rwc)
+		if p, ok := port.(dtrSetter); ok && cfg.UseDTR {
+			setDirection = p.SetDTR
+		} else if p, ok := port.(rtsSetter); ok && !cfg.UseDTR {
+			setDirection = p.SetRTS
+		} else {
+			return nil, ErrNotSupported
+		}
+	}
+	err := setDirection(false)
+	if err != nil {
+		return nil, err
+	}
+	return &HalfDuplex{
+		rwc:          rwc,
+		mode:         cfg.Mode,
+		guard:        cfg.GuardTime,
+		setDirection: setDirection,
+	}, nil
+}
+
+// Write sets the direction to transmit, writes b and waits until b has been transmitted
+// before setting the direction back to receive.
+func (hd *HalfDuplex) Write(b []byte) (int, error) {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	err := hd.setDirection(true)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	n, err := hd.rwc.Write(b)
+	// Write usually returns once data is in the OS buffer so wait for it to clear the wire.
+	time.Sleep(time.Until(start.Add(hd.mode.TransmitDuration(n) + hd.guard)))
+	return n, errors.Join(err, hd.setDirection(false))
+}
+
+// Underlying returns the wrapped port. It is an escape hatch to access backend specific functionality.
+// Writing to the returned port bypasses the direction switching of HalfDuplex.
+func (hd *HalfDuplex) Underlying() io.ReadWriteCloser {
+	return hd.rwc
+}
+
+// Read reads from the underlying port.
+func (hd *HalfDuplex) Read(b []byte) (int, error) {
+	return hd.rwc.Read(b)
+}
+
+// Close closes the underlying port.
+func (hd *HalfDuplex) Close() error {
+	return hd.rwc.Close()
+}
@@ -0,0 +1,196 @@
+//go:build linux
+
+package cereal
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialICounter mirrors the Linux serial_icounter_struct.
+type serialICounter struct {
+	cts, dsr, rng, dcd int32
+	rx, tx             int32
+	frame, overrun     int32
+	parity, brk        int32
+	bufOverrun         int32
+	reserved           [9]int32
+}
+
+// serialStruct mirrors the Linux serial_struct used by TIOCGSERIAL and TIOCSSERIAL.
+type serialStruct struct {
+	typ, line     int32
+	port          uint32
+	irq           int32
+	flags         int32
+	xmitFifoSize  int32
+	customDivisor int32
+	baudBase      int32
+	closeDelay    uint16
+	ioType        uint8
+	reservedChar  [1]uint8
+	hub6          int32
+	closingWait   uint16
+	closingWait2  uint16
+	iomemBase     uintptr
+	iomemRegShift uint16
+	portHigh      uint32
+	iomapBase     uintptr
+}
+
+// asyncLowLatency is the ASYNC_LOW_LATENCY serial_struct flag.
+const asyncLowLatency = 1 << 13
+
+func portErrors(fd uintptr) (framing, parity, overrun uint64, err error) {
+	var ic serialICounter
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCGICOUNT, uintptr(unsafe.Pointer(&ic)))
+	if errno != 0 {
+		return 0, 0, 0, errno
+	}
+	return uint64(uint32(ic.frame)), uint64(uint32(ic.parity)), uint64(uint32(ic.overrun)) + uint64(uint32(ic.bufOverrun)), nil
+}
+
+func lockExclusive(port io.ReadWriteCloser) error {
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	err = unix.Flock(int(fd), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		return ErrPortBusy
+	} else if err != nil {
+		return err
+	}
+	// Prevent further opens of the tty, including those that do not check flock.
+	return unix.IoctlSetInt(int(fd), unix.TIOCEXCL, 0)
+}
+
+// keepDTROnClose clears HUPCL so that the modem lines are not dropped when the port is closed.
+func keepDTROnClose(port io.ReadWriteCloser) error {
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	tio, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		return err
+	} else if tio.Cflag&unix.HUPCL == 0 {
+		return nil
+	}
+	// TCSETS keeps the speed set by TCSETS2 for baud rates without a Bxxx constant.
+	tio.Cflag &^= unix.HUPCL
+	return unix.IoctlSetTermios(int(fd), unix.TCSETS, tio)
+}
+
+// flushTerminal discards data received but not read and data written but not transmitted.
+func flushTerminal(fd uintptr) error {
+	return unix.IoctlSetInt(int(fd), unix.TCFLSH, unix.TCIOFLUSH)
+}
+
+// setTermiosParity changes the parity of the terminal, see modifyTermios.
+func setTermiosParity(fd uintptr, parity Parity) error {
+	return modifyTermios(fd, func(tio *unix.Termios) error {
+		tio.Cflag &^= unix.PARENB | unix.PARODD | unix.CMSPAR
+		tio.Iflag &^= unix.INPCK
+		switch parity {
+		case ParityNone:
+			return nil
+		case ParityOdd:
+			tio.Cflag |= unix.PARENB | unix.PARODD
+		case ParityEven:
+			tio.Cflag |= unix.PARENB
+		case ParityMark:
+			tio.Cflag |= unix.PARENB | unix.CMSPAR | unix.PARODD
+		case ParitySpace:
+			tio.Cflag |= unix.PARENB | unix.CMSPAR
+		default:
+			return errInvalidParity
+		}
+		tio.Iflag |= unix.INPCK
+		return nil
+	})
+}
+
+// setTermiosStopBits changes the stop bits of the terminal, see modifyTermios.
+func setTermiosStopBits(fd uintptr, stopBits StopBits) error {
+	return modifyTermios(fd, func(tio *unix.Termios) error {
+		switch stopBits {
+		case StopBits1:
+			tio.Cflag &^= unix.CSTOPB
+		case StopBits1Half:
+			// UARTs send 1.5 stop bits when two are requested with 5 bit characters.
+			if tio.Cflag&unix.CSIZE != unix.CS5 {
+				return errUnsupportedStopbits
+			}
+			tio.Cflag |= unix.CSTOPB
+		case StopBits2:
+			tio.Cflag |= unix.CSTOPB
+		default:
+			return errInvalidStopbits
+		}
+		return nil
+	})
+}
+
+// modifyTermios applies modify to the terminal's attributes once pending output has been
+// transmitted, discarding input received with the previous attributes.
+func modifyTermios(fd uintptr, modify func(*unix.Termios) error) error {
+	tio, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	err = modify(tio)
+	if err != nil {
+		return err
+	}
+	// TCSETSF drains output and flushes input. It keeps the speed set by TCSETS2.
+	return unix.IoctlSetTermios(int(fd), unix.TCSETSF, tio)
+}
+
+// drainTerminal waits until all output written to fd has been transmitted, like tcdrain.
+func drainTerminal(fd uintptr) error {
+	return unix.IoctlSetInt(int(fd), unix.TCSBRK, 1)
+}
+
+// setLowLatency sets or clears the ASYNC_LOW_LATENCY flag of the serial driver.
+func setLowLatency(fd uintptr, enable bool) error {
+	var ss serialStruct
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCGSERIAL, uintptr(unsafe.Pointer(&ss)))
+	if errno == unix.ENOTTY || errno == unix.EINVAL {
+		return fmt.Errorf("%w: low latency mode for driver: %v", ErrNotSupported, errno)
+	} else if errno != 0 {
+		return errno
+	}
+	if enable {
+		ss.flags |= asyncLowLatency
+	} else {
+		ss.flags &^= asyncLowLatency
+	}
+	_, _, errno = unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCSSERIAL, uintptr(unsafe.Pointer(&ss)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// waitReadable waits up to timeout for fd to become readable. Hang ups and errors
+// are reported as readable so the following read returns the error.
+func waitReadable(fd uintptr, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err == unix.EINTR {
+		return false, nil
+	}
+	return n > 0, err
+}
+
+// hungUp reports whether the other end of the terminal fd hung up, i.e. the device was unplugged.
+func hungUp(fd uintptr) bool {
+	fds := []unix.PollFd{{Fd: int32(fd)}}
+	n, err := unix.Poll(fds, 0)
+	return err == nil && n > 0 && fds[0].Revents&unix.POLLHUP != 0
+}
@@ -0,0 +1,52 @@
+//go:build !linux
+
+package cereal
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+func portErrors(fd uintptr) (framing, parity, overrun uint64, err error) {
+	return 0, 0, 0, ErrNotSupported
+}
+
+func lockExclusive(port io.ReadWriteCloser) error {
+	if runtime.GOOS == "windows" {
+		return nil // Serial ports are always opened exclusively on windows.
+	}
+	return ErrNotSupported
+}
+
+func keepDTROnClose(port io.ReadWriteCloser) error {
+	return ErrNotSupported
+}
+
+func flushTerminal(fd uintptr) error {
+	return ErrNotSupported
+}
+
+func setTermiosParity(fd uintptr, parity Parity) error {
+	return ErrNotSupported
+}
+
+func setTermiosStopBits(fd uintptr, stopBits StopBits) error {
+	return ErrNotSupported
+}
+
+func drainTerminal(fd uintptr) error {
+	return ErrNotSupported
+}
+
+func setLowLatency(fd uintptr, enable bool) error {
+	return ErrNotSupported
+}
+
+func waitReadable(fd uintptr, timeout time.Duration) (bool, error) {
+	return false, ErrNotSupported
+}
+
+func hungUp(fd uintptr) bool {
+	return false
+}
@@ -0,0 +1,130 @@
+package cereal
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// LengthPrefixedFramer writes and reads messages preceded by their length, i.e. a 2 byte big-endian
+// length followed by that many payload bytes. The length counts only the payload, not the prefix.
+type LengthPrefixedFramer struct {
+	nb       *NonBlocking
+	size     int
+	order    binary.ByteOrder
+	maxFrame int
+	// pending holds the received bytes of the message being read, including its prefix.
+	pending []byte
+	// skip is the amount of bytes of an oversized message left to discard.
+	skip uint64
+}
+
+// NewLengthPrefixedFramer returns a LengthPrefixedFramer reading and writing messages over rwc with a
+// length prefix of prefixSize bytes, which must be 1, 2 or 4, encoded with order. order may be nil
+// for 1 byte prefixes. If rwc is not a [NonBlocking] it is wrapped in one so that reads can time out.
+func NewLengthPrefixedFramer(rwc io.ReadWriteCloser, prefixSize int, order binary.ByteOrder) *LengthPrefixedFramer {
+	if prefixSize != 1 && prefixSize != 2 && prefixSize != 4 {
+		panic("invalid length prefix size")
+	} else if order == nil && prefixSize != 1 {
+		panic("nil byte order for multi-byte length prefix")
+	}
+	nb, ok := rwc.(*NonBlocking)
+	if !ok {
+		nb = NewNonBlocking(rwc, NonBlockingConfig{})
+	}
+	return &LengthPrefixedFramer{nb: nb, size: prefixSize, order: order}
+}
+
+// SetMaxFrameSize limits the length of received message payloads to n bytes. Longer messages
+// are discarded as they are received and [ErrFrameTooLarge] is returned. This guards against
+// absurd lengths received from a misbehaving device or after losing synchronization.
+// A value of zero, the default, sets no limit other than the one imposed by the prefix size.
+func (lf *LengthPrefixedFramer) SetMaxFrameSize(n int) {
+	if n < 0 {
+		panic("invalid max frame size")
+	}
+	lf.maxFrame = n
+}
+
+// WriteMessage writes the length prefix followed by b. If the length of b does not fit
+// in the prefix [ErrFrameTooLarge] is returned and nothing is written.
+func (lf *LengthPrefixedFramer) WriteMessage(b []byte) error {
+	msg := make([]byte, lf.size, lf.size+len(b))
+	switch {
+	case lf.size == 1 && len(b) <= math.MaxUint8:
+		msg[0] = byte(len(b))
+	case lf.size == 2 && len(b) <= math.MaxUint16:
+		lf.order.PutUint16(msg, uint16(len(b)))
+	case lf.size == 4 && uint64(len(b)) <= math.MaxUint32:
+		lf.order.PutUint32(msg, uint32(len(b)))
+	default:
+		return ErrFrameTooLarge
+	}
+	_, err := lf.nb.WriteFrame(append(msg, b...))
+	return err
+}
+
+// ReadMessage reads the next message received before the deadline and returns its payload.
+// If the deadline passes mid-message the bytes received so far are kept and the message is
+// completed by the next call. If the message is larger than the maximum frame size it is
+// discarded and [ErrFrameTooLarge] is returned.
+func (lf *LengthPrefixedFramer) ReadMessage(deadline time.Time) ([]byte, error) {
+	var buf [256]byte
+	for {
+		// Only the bytes needed are read so that the following message stays buffered.
+		need := len(buf)
+		switch {
+		case lf.skip > 0:
+			if lf.skip < uint64(need) {
+				need = int(lf.skip)
+			}
+		case len(lf.pending) < lf.size:
+			need = lf.size - len(lf.pending)
+		default:
+			n := lf.length()
+			if n > math.MaxInt-uint64(lf.size) || (lf.maxFrame > 0 && n > uint64(lf.maxFrame)) {
+				lf.skip = n
+				lf.pending = lf.pending[:0]
+				return nil, ErrFrameTooLarge
+			}
+			need = lf.size + int(n) - len(lf.pending)
+			if need == 0 {
+				msg := append([]byte(nil), lf.pending[lf.size:]...)
+				lf.pending = lf.pending[:0]
+				return msg, nil
+			}
+		}
+		if need > len(buf) {
+			need = len(buf)
+		}
+		n, err := lf.nb.readNext(buf[:need], deadline)
+		if err != nil {
+			return nil, err
+		}
+		if lf.skip > 0 {
+			lf.skip -= uint64(n)
+		} else {
+			lf.pending = append(lf.pending, buf[:n]...)
+		}
+	}
+}
+
+// length decodes the length prefix of the pending message.
+func (lf *LengthPrefixedFramer) length() uint64 {
+	var n uint64
+	switch lf.size {
+	case 1:
+		n = uint64(lf.pending[0])
+	case 2:
+		n = uint64(lf.order.Uint16(lf.pending))
+	case 4:
+		n = uint64(lf.order.Uint32(lf.pending))
+	}
+	return n
+}
+
+// Close closes the underlying port.
+func (lf *LengthPrefixedFramer) Close() error {
+	return lf.nb.Close()
+}
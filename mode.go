@@ -2,6 +2,9 @@ package cereal
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,21 +13,148 @@ type Mode struct {
 	BaudRate int
 	// DataBits 5, 6, 7, 8. If Zero then 8 is used.
 	DataBits int
-	// ReadTimeout is the maximum time to wait for a read to complete.
-	// May not be implemented on all platforms or Opener implementations.
+	// ReadTimeout is the maximum time a Read waits for data. All Openers in this package implement
+	// the same semantics: a Read returns as soon as any data is received, possibly less than len(b),
+	// with a nil error. If no data is received within ReadTimeout it returns 0 and [ErrReadTimeout].
+	// The backends report timeouts differently, i.e. as an empty read or as io.EOF, so Openers wrap the
+	// port to normalize them. When the other end hangs up, i.e. a USB adapter is unplugged, Reads return
+	// io.EOF or the backend's error instead. On Linux hang ups reported by the backend as timeouts are
+	// detected by polling the port's descriptor. If zero Reads block until data is received.
 	//
-	// This value corresponds to VTIM in termios implementations.
+	// May not be implemented on all Opener implementations, see [Capabilities] and [OpenWithTimeout].
+	// This value corresponds to VTIME in termios implementations. [NonBlockingConfig.ReadTimeout]
+	// differs in that its Read waits until b is filled or the timeout elapses.
 	ReadTimeout time.Duration
-	Parity      Parity
-	StopBits    StopBits
+	// WriteTimeout is the maximum time to wait for a write to complete before returning [ErrWriteTimeout].
+	// Writes can block when the OS output buffer is full, for instance if the device asserted flow control.
+	// None of the backend libraries expose a driver write timeout so it is implemented by all Openers
+	// in this package by running writes in a separate goroutine. A timed out write may still complete
+	// at a later time. If zero writes block until completed.
+	WriteTimeout time.Duration
+	// MaxWriteChunk splits writes larger than MaxWriteChunk bytes into chunks. After each chunk the
+	// write pauses for the chunk's [Mode.TransmitDuration] plus InterChunkDelay so that the device
+	// drains its FIFO before the next chunk arrives. This prevents cheap USB adapters without flow
+	// control from dropping bytes on large writes at low baud rates. If zero writes are not split.
+	MaxWriteChunk int
+	// InterChunkDelay is the pause added between chunks when MaxWriteChunk is set.
+	InterChunkDelay time.Duration
+	Parity          Parity
+	StopBits        StopBits
+	// Exclusive requests exclusive access to the port. If another process already holds
+	// the port open exclusively the open fails with [ErrPortBusy]. On Linux an advisory lock
+	// (flock) is taken on the device and the TIOCEXCL mode is set, both are released when the port
+	// is closed. Windows always opens ports exclusively. Other platforms return [ErrNotSupported].
+	Exclusive bool
+	// NoResetOnOpen keeps DTR asserted when the port is closed so that reopening it does not reset
+	// boards such as Arduinos, whose reset is triggered by DTR being asserted after having been dropped.
+	// This is useful for monitor-only connections. On Linux the HUPCL flag is cleared for all backends;
+	// the OS asserts DTR on open regardless, so the first open after the device is plugged in still resets it
+	// but later opens, also by other programs, do not. Other platforms return [ErrNotSupported].
+	NoResetOnOpen bool
+}
+
+// ParseMode parses a mode in the conventional "baud,databits,parity,stopbits" form, i.e. "115200,8,N,1".
+// Parity may be given by its first character or full name, see [ParseParity]. An optional fifth field
+// sets the ReadTimeout and is parsed with [time.ParseDuration], i.e. "9600,8,E,2,100ms".
+func ParseMode(s string) (Mode, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 && len(fields) != 5 {
+		return Mode{}, fmt.Errorf("invalid mode %q: expected baud,databits,parity,stopbits[,timeout]", s)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	var m Mode
+	var err error
+	m.BaudRate, err = strconv.Atoi(fields[0])
+	if err != nil || m.BaudRate <= 0 {
+		return Mode{}, fmt.Errorf("invalid baud rate %q", fields[0])
+	}
+	m.DataBits, err = strconv.Atoi(fields[1])
+	if err != nil || m.DataBits < 5 || m.DataBits > 8 {
+		return Mode{}, fmt.Errorf("invalid data bits %q", fields[1])
+	}
+	m.Parity, err = ParseParity(fields[2])
+	if err != nil {
+		return Mode{}, err
+	}
+	m.StopBits, err = ParseStopBits(fields[3])
+	if err != nil {
+		return Mode{}, err
+	}
+	if len(fields) == 5 {
+		m.ReadTimeout, err = time.ParseDuration(fields[4])
+		if err != nil || m.ReadTimeout < 0 {
+			return Mode{}, fmt.Errorf("invalid read timeout %q", fields[4])
+		}
+	}
+	return m, nil
+}
+
+// String returns the mode in the canonical form parsed by [ParseMode], i.e. "115200,8,N,1".
+// The read timeout is appended as a fifth field if non-zero.
+func (m Mode) String() string {
+	databits := m.DataBits
+	if databits == 0 {
+		databits = 8
+	}
+	s := strconv.Itoa(m.BaudRate) + "," + strconv.Itoa(databits) + "," + string(m.Parity.Char()) + "," + m.StopBits.String()
+	if m.ReadTimeout != 0 {
+		s += "," + m.ReadTimeout.String()
+	}
+	return s
+}
+
+// Set parses s with [ParseMode] and sets the mode. It implements [flag.Value] with [Mode.String].
+func (m *Mode) Set(s string) error {
+	mode, err := ParseMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// TransmitDuration returns the time it takes to transmit n bytes over the wire with
+// the mode's baud rate and frame format, accounting for the start bit, data bits,
+// parity bit and stop bits of each character. Returns 0 if BaudRate is not positive.
+func (m Mode) TransmitDuration(n int) time.Duration {
+	if m.BaudRate <= 0 {
+		return 0
+	}
+	m, _ = m.withDefaults()
+	parity := 0
+	if m.Parity != ParityNone {
+		parity = 1
+	}
+	// Work in half bits to account for 1.5 stop bits.
+	halvesPerChar := 2*(1+m.DataBits+parity) + m.StopBits.Halves()
+	return time.Duration(n) * time.Duration(halvesPerChar) * time.Second / time.Duration(2*m.BaudRate)
+}
+
+// withDefaults returns m with the documented defaults applied: a DataBits of zero becomes 8.
+// An error is returned if DataBits is out of range or the write chunking is negative.
+func (m Mode) withDefaults() (Mode, error) {
+	if m.DataBits == 0 {
+		m.DataBits = 8
+	} else if m.DataBits < 5 || m.DataBits > 8 {
+		return m, errInvalidDataBits
+	}
+	if m.MaxWriteChunk < 0 || m.InterChunkDelay < 0 {
+		return m, errInvalidWriteChunk
+	}
+	return m, nil
 }
 
 var (
-	errReadTimeoutUnsupportedBugst = errors.New("read timeout not supported for Opener implementation. Use a different Opener")
-	errUnsupportedStopbits         = errors.New("stop bits unsupported")
-	errInvalidStopbits             = errors.New("invalid stop bits")
+	errInvalidDataBits        = errors.New("invalid data bits")
+	errInvalidWriteChunk      = errors.New("invalid write chunk size or delay")
+	errUnsupportedReadTimeout = fmt.Errorf("%w: read timeout for Opener implementation. Use a different Opener", ErrNotSupported)
+	errUnsupportedStopbits    = fmt.Errorf("%w: stop bits", ErrNotSupported)
+	errInvalidStopbits        = errors.New("invalid stop bits")
+	errTermiosReadTimeout     = fmt.Errorf("%w: termios read timeout over 25.5s", ErrNotSupported)
 
-	errUnsupportedParity = errors.New("unsupported parity")
+	errUnsupportedParity = fmt.Errorf("%w: parity", ErrNotSupported)
 	errInvalidParity     = errors.New("invalid parity")
 )
 
@@ -53,6 +183,30 @@ func (s StopBits) String() (str string) {
 	return str
 }
 
+// ParseStopBits parses the stop bits from their string representation: "1", "1.5" or "2".
+// It is the inverse of [StopBits.String].
+func ParseStopBits(s string) (StopBits, error) {
+	switch s {
+	case "1":
+		return StopBits1, nil
+	case "1.5":
+		return StopBits1Half, nil
+	case "2":
+		return StopBits2, nil
+	}
+	return 0, fmt.Errorf("%w %q", errInvalidStopbits, s)
+}
+
+// Set parses s with [ParseStopBits] and sets the stop bits. It implements [flag.Value] with [StopBits.String].
+func (s *StopBits) Set(str string) error {
+	stopbits, err := ParseStopBits(str)
+	if err != nil {
+		return err
+	}
+	*s = stopbits
+	return nil
+}
+
 // Halves returns the number of half bits for the stop bits. If invalid returns 0.
 func (s StopBits) Halves() (halves int) {
 	switch s {
@@ -63,7 +217,7 @@ func (s StopBits) Halves() (halves int) {
 	case StopBits2:
 		halves = 4
 	}
-	return 0
+	return halves
 }
 
 // Parity is the type of parity to use- is a enum so use package defined
@@ -86,6 +240,27 @@ var parityTable = [...]string{
 	ParitySpace: "Space",
 }
 
+// ParseParity parses a parity from its name ("none", "odd", "even", "mark" or "space")
+// or its first character ("N", "O", "E", "M" or "S"). Parsing is case-insensitive.
+func ParseParity(s string) (Parity, error) {
+	for i, name := range parityTable {
+		if name != "" && (strings.EqualFold(s, name) || strings.EqualFold(s, name[:1])) {
+			return Parity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errInvalidParity, s)
+}
+
+// Set parses s with [ParseParity] and sets the parity. It implements [flag.Value] with [Parity.String].
+func (p *Parity) Set(s string) error {
+	parity, err := ParseParity(s)
+	if err != nil {
+		return err
+	}
+	*p = parity
+	return nil
+}
+
 // String returns a human readable representation of the parity.
 func (p Parity) String() (s string) {
 	if int(p) >= len(parityTable) || parityTable[p] == "" {
@@ -94,10 +269,21 @@ func (p Parity) String() (s string) {
 	return parityTable[p]
 }
 
+// Char returns the first character of the parity name, i.e. 'N' for ParityNone.
+// Returns '?' for invalid parity values. See [Parity.CharErr].
 func (p Parity) Char() (char byte) {
-	str := p.String()
-	if str[0] == '<' {
+	char, err := p.CharErr()
+	if err != nil {
 		return '?'
 	}
-	return str[0]
+	return char
+}
+
+// CharErr returns the first character of the parity name, i.e. 'N' for ParityNone,
+// or an error if the parity is not valid.
+func (p Parity) CharErr() (char byte, err error) {
+	if int(p) >= len(parityTable) || parityTable[p] == "" {
+		return 0, errInvalidParity
+	}
+	return parityTable[p][0], nil
 }
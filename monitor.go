@@ -0,0 +1,68 @@
+package cereal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Monitor copies data received from port to out and data read from in to port until ctx is cancelled,
+// which is the core of a terminal program such as screen or minicom, i.e. with in set to os.Stdin
+// and out to os.Stdout. It returns ctx.Err() when ctx is cancelled, nil once in or the port reach
+// io.EOF and otherwise the first error reading or writing.
+//
+// If port is not a [NonBlocking] it is wrapped in one so that waiting for data does not delay returning
+// on cancellation. Monitor does not close port; the background reader of the wrapping NonBlocking keeps
+// reading port until it is closed, so pass a NonBlocking to keep using the port after Monitor returns.
+// Reads from in can't be interrupted, so the goroutine reading in is abandoned on return and lives until
+// its read in progress returns. Its data is then discarded.
+func Monitor(ctx context.Context, port io.ReadWriteCloser, in io.Reader, out io.Writer) error {
+	nb, ok := port.(*NonBlocking)
+	if !ok {
+		nb = NewNonBlocking(port, NonBlockingConfig{})
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	inDone := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 && ctx.Err() == nil {
+				_, werr := nb.WriteFrame(buf[:n])
+				if werr != nil {
+					inDone <- werr
+					return
+				}
+			}
+			if err != nil {
+				inDone <- err
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 256)
+	for {
+		select {
+		case err := <-inDone:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		// Wait for data briefly to notice the above.
+		n, err := nb.readNext(buf, time.Now().Add(50*time.Millisecond))
+		if n > 0 {
+			_, err = out.Write(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil && err != errDeadlineExceeded {
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package cereal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// multiPortPoll is the interval at which MultiPort polls its ports for data.
+const multiPortPoll = 10 * time.Millisecond
+
+var (
+	errMultiPortClosed    = errors.New("multiport closed")
+	errMultiPortDuplicate = errors.New("multiport already contains port with that name")
+)
+
+// PortMessage is data read from one of the ports of a [MultiPort].
+type PortMessage struct {
+	// Port is the name the port was added to the MultiPort with.
+	Port string
+	// Data is the data read from the port. It is not shared with other messages.
+	Data []byte
+	// Err is set when the port's reader failed. It is the last message received from the port.
+	Err error
+}
+
+// MultiPort multiplexes the data read from several [NonBlocking] ports into a single channel,
+// tagging each message with the name of its source port. Ports may be added and removed
+// while the MultiPort is in use. A port whose reader fails reports the error in a final
+// message and stops being read, without affecting the other ports.
+//
+// MultiPort is safe for concurrent use.
+type MultiPort struct {
+	msgs   chan PortMessage
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	ports  map[string]*multiPortEntry
+	closed bool
+}
+
+type multiPortEntry struct {
+	nb *NonBlocking
+	// done is closed to stop the entry's read goroutine and exited is closed once it returns.
+	done   chan struct{}
+	exited chan struct{}
+}
+
+// NewMultiPort returns a MultiPort with no ports.
+func NewMultiPort() *MultiPort {
+	return &MultiPort{
+		msgs:  make(chan PortMessage, 16),
+		ports: make(map[string]*multiPortEntry),
+	}
+}
+
+// Messages returns the channel on which data read from all ports is received.
+// The channel is closed after Close is called.
+func (mp *MultiPort) Messages() <-chan PortMessage {
+	return mp.msgs
+}
+
+// Add starts reading from nb, tagging its messages with name. Names must be unique.
+// The MultiPort takes ownership of nb's read side: nb should not be read by other callers.
+func (mp *MultiPort) Add(name string, nb *NonBlocking) error {
+	if nb == nil {
+		panic("nil NonBlocking passed into MultiPort.Add")
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if mp.closed {
+		return errMultiPortClosed
+	} else if _, ok := mp.ports[name]; ok {
+		return errMultiPortDuplicate
+	}
+	e := &multiPortEntry{nb: nb, done: make(chan struct{}), exited: make(chan struct{})}
+	mp.ports[name] = e
+	mp.wg.Add(1)
+	go mp.readLoop(name, e)
+	return nil
+}
+
+// Remove stops reading from the port added with name and returns it, or nil if there is no such port.
+// The port is not closed. Once Remove returns no more messages from the port are sent.
+func (mp *MultiPort) Remove(name string) *NonBlocking {
+	mp.mu.Lock()
+	e, ok := mp.ports[name]
+	delete(mp.ports, name)
+	mp.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	close(e.done)
+	<-e.exited
+	return e.nb
+}
+
+// Ports returns the names of the ports currently in the MultiPort.
+func (mp *MultiPort) Ports() []string {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	names := make([]string, 0, len(mp.ports))
+	for name := range mp.ports {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Close stops reading from and closes all ports, then closes the Messages channel.
+// It returns the errors returned by closing the ports.
+func (mp *MultiPort) Close() error {
+	mp.mu.Lock()
+	if mp.closed {
+		mp.mu.Unlock()
+		return errMultiPortClosed
+	}
+	mp.closed = true
+	ports := mp.ports
+	mp.ports = nil
+	mp.mu.Unlock()
+	var errs []error
+	for _, e := range ports {
+		close(e.done)
+		<-e.exited
+		errs = append(errs, e.nb.Close())
+	}
+	mp.wg.Wait()
+	close(mp.msgs)
+	return errors.Join(errs...)
+}
+
+func (mp *MultiPort) readLoop(name string, e *multiPortEntry) {
+	defer mp.wg.Done()
+	defer close(e.exited)
+	buf := make([]byte, 1024)
+	for {
+		n, err := e.nb.readBuffered(buf)
+		var msg PortMessage
+		switch {
+		case n > 0:
+			msg = PortMessage{Port: name, Data: append([]byte(nil), buf[:n]...)}
+		case err != nil:
+			msg = PortMessage{Port: name, Err: err}
+		default:
+			select {
+			case <-e.done:
+				return
+			case <-time.After(multiPortPoll):
+			}
+			continue
+		}
+		select {
+		case <-e.done:
+			return
+		case mp.msgs <- msg:
+		}
+		if msg.Err != nil {
+			return
+		}
+	}
+}
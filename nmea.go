@@ -0,0 +1,95 @@
+package cereal
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"time"
+)
+
+// NMEAReader reads NMEA 0183 sentences, such as those sent by GPS receivers.
+type NMEAReader struct {
+	nb       *NonBlocking
+	pending  []byte
+	maxFrame int
+}
+
+// NewNMEAReader returns an NMEAReader reading sentences from rwc. If rwc is not a [NonBlocking]
+// it is wrapped in one so that reads can time out.
+func NewNMEAReader(rwc io.ReadWriteCloser) *NMEAReader {
+	nb, ok := rwc.(*NonBlocking)
+	if !ok {
+		nb = NewNonBlocking(rwc, NonBlockingConfig{})
+	}
+	return &NMEAReader{nb: nb}
+}
+
+// SetMaxFrameSize limits the length of received sentences, including the line ending, to n bytes.
+// Longer sentences are discarded and [ErrFrameTooLarge] is returned. This bounds the memory used
+// when a device sends garbage that never ends in a newline. The NMEA 0183 standard limits sentences
+// to 82 characters though some devices send longer proprietary sentences.
+// A value of zero, the default, sets no limit.
+func (nr *NMEAReader) SetMaxFrameSize(n int) {
+	if n < 0 {
+		panic("invalid max frame size")
+	}
+	nr.maxFrame = n
+}
+
+// ReadSentence reads the next "$...*XX\r\n" sentence received before the deadline and returns it
+// without the trailing "\r\n", i.e. "$GPGLL,4916.45,N,12311.12,W,225444,A*31". Bytes received before
+// the starting '$' and incomplete sentences are skipped, so reading may start mid-sentence.
+// If the sentence checksum is missing or does not match the sentence is consumed and [ErrBadChecksum] is returned.
+func (nr *NMEAReader) ReadSentence(deadline time.Time) (string, error) {
+	var buf [256]byte
+	for {
+		start := bytes.IndexByte(nr.pending, '$')
+		if start < 0 {
+			nr.pending = nr.pending[:0] // Garbage before sentence start.
+		} else if end := bytes.IndexByte(nr.pending[start:], '\n'); end >= 0 {
+			line := nr.pending[start : start+end]
+			nr.pending = nr.pending[start+end+1:]
+			// Skip incomplete sentence interrupted by the start of a new one.
+			line = line[bytes.LastIndexByte(line, '$'):]
+			if nr.maxFrame > 0 && len(line)+1 > nr.maxFrame {
+				return "", ErrFrameTooLarge
+			}
+			sentence := bytes.TrimRight(line, "\r")
+			if !nmeaChecksumOK(sentence) {
+				return "", ErrBadChecksum
+			}
+			return string(sentence), nil
+		} else if nr.maxFrame > 0 && len(nr.pending)-start > nr.maxFrame {
+			nr.pending = nr.pending[:0] // Discard oversized sentence and resync on next '$'.
+			return "", ErrFrameTooLarge
+		}
+		n, err := nr.nb.readNext(buf[:], deadline)
+		if err != nil {
+			return "", err
+		}
+		nr.pending = append(nr.pending, buf[:n]...)
+	}
+}
+
+// Close closes the underlying port.
+func (nr *NMEAReader) Close() error {
+	return nr.nb.Close()
+}
+
+// nmeaChecksumOK reports whether sentence, starting with '$' and without the line ending, ends with
+// a "*XX" checksum matching the XOR of all bytes between the '$' and the '*'.
+func nmeaChecksumOK(sentence []byte) bool {
+	star := len(sentence) - 3
+	if star < 1 || sentence[star] != '*' {
+		return false
+	}
+	want, err := strconv.ParseUint(string(sentence[star+1:]), 16, 8)
+	if err != nil {
+		return false
+	}
+	var sum byte
+	for _, c := range sentence[1:star] {
+		sum ^= c
+	}
+	return sum == byte(want)
+}
@@ -5,16 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var _ io.ReadWriteCloser = &NonBlocking{}
+var (
+	_ io.ReadWriteCloser = &NonBlocking{}
+	_ io.StringWriter    = &NonBlocking{}
+	_ io.WriterTo        = &NonBlocking{}
+	_ io.ReaderFrom      = &NonBlocking{}
+)
 
 var (
-	errDeadlineExceeded = errors.New("blocking deadline exceeded")
+	// errDeadlineExceeded is returned when a read deadline passes.
+	errDeadlineExceeded error = &timeoutError{msg: "blocking deadline exceeded"}
+	// ErrPortDisconnected is returned by NonBlocking reads after the underlying reader
+	// failed with an error indicating the device was disconnected, i.e. a USB adapter was unplugged.
+	// The returned error also wraps the original error returned by the reader.
+	ErrPortDisconnected = errors.New("port disconnected")
+	// ErrReaderPanicked is returned by NonBlocking reads after the underlying reader panicked.
+	// The error message includes the recovered value and the stack trace of the panic.
+	ErrReaderPanicked = errors.New("panic in NonBlocking read goroutine")
+	// ErrNotWritable is returned by writes to a NonBlocking created with [NewNonBlockingReader].
+	ErrNotWritable = errors.New("NonBlocking not writable")
+	// ErrClosed is returned by writes to a NonBlocking after Close, regardless of the error the
+	// underlying port would return. It wraps [net.ErrClosed] so errors.Is(err, net.ErrClosed) is true.
+	ErrClosed error = &closedError{}
 )
 
+type closedError struct{}
+
+func (*closedError) Error() string { return "NonBlocking closed" }
+func (*closedError) Unwrap() error { return net.ErrClosed }
+
 // NonBlocking implements io.Reader non-blocking behaviour. This is particular functionality is suited
 // when developing message-based protocols over serial communication.
 //
@@ -23,39 +50,210 @@ var (
 // it will block on the Read call. If each device is wrapped with a NonBlocking and a timeout is set
 // then the user can expect all Read calls to terminate withing the deadline/timeout given.
 type NonBlocking struct {
-	io             io.ReadWriteCloser
-	defaultTimeout time.Duration
-	maxBuffered    int
+	io          io.ReadWriteCloser
+	read        func([]byte) (int, error)
+	maxBuffered int
+	maxErrors   int
+	logger      func(event string, data []byte, err error)
+	idleEvery   time.Duration
+	idleFunc    func() []byte
+	xonxoff     bool
+	onFull      func(buffered int)
+	// poller drives the reader if the NonBlocking was created by a Poller.
+	poller    *Poller
+	startOnce sync.Once
+	// done is closed when the background read goroutine exits.
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// buffered mirrors buf.Len() and readSize is the configured read size. They are atomic so
+	// the background goroutine and Buffered do not contend with readers on mu.
+	buffered atomic.Int64
+	readSize atomic.Int64
+	// wmu serializes writes to the underlying writer.
+	wmu sync.Mutex
+	// mu guards all fields below.
 	mu             sync.Mutex
-	buf            bytes.Buffer
+	defaultTimeout time.Duration
+	buf            Buffer
 	errfield       error
+	closed         bool
+	stats          NonBlockingStats
+	// discardUntil is the time until which read data is discarded.
+	discardUntil time.Time
+	// reserved is the buffer space reserved for the read in progress, see reserveRead.
+	reserved int
+	// lastData is the time data was last read from the underlying reader or keep-alive data was written.
+	lastData time.Time
+	// xon is non-nil while writes are paused by a received XOFF and is closed to resume them.
+	xon chan struct{}
+}
+
+// NonBlockingStats contains counters of the activity of the NonBlocking background reader.
+// They are useful for empirically tuning MaxReadSize and timeouts.
+type NonBlockingStats struct {
+	// BytesRead is the total amount of bytes read from the underlying reader.
+	BytesRead uint64
+	// Reads is the amount of calls to the underlying reader's Read method.
+	Reads uint64
+	// EmptyReads is the amount of reads that returned zero bytes.
+	EmptyReads uint64
+	// BackoffSleeps is the amount of times the reader slept due to an empty read or a full buffer.
+	BackoffSleeps uint64
+}
+
+// Buffer is the storage used by [NonBlocking] to hold bytes read by the background goroutine
+// until they are consumed by the caller. [bytes.Buffer] implements Buffer.
+//
+// Read should return the bytes in the order they were written. Write must store all of b;
+// bytes not stored are lost. Len must return the exact amount of bytes pending to be read since
+// it is used to enforce MaxReadBuffered: the background goroutine stops reading while Len is
+// greater or equal to MaxReadBuffered and limits each read to the remaining space, so at most
+// MaxReadBuffered bytes are held in a Buffer. Fixed-capacity implementations should be sized accordingly.
+// Buffer methods are always called with the NonBlocking mutex held so they need not be concurrent safe.
+type Buffer interface {
+	io.ReadWriter
+	Len() int
+	Reset()
 }
 
 // NonBlockingConfig is used to configure the creation of a NonBlocking instance.
 type NonBlockingConfig struct {
 	// ReadTimeout will define the timeout to wait on a Read call before returning deadline exceeded error.
 	// If ReadTimeout is zero then Read calls will return immediately and only have an error if the Reader
-	// was closed or EOFed. This value loosely corresponds to VTIME in termios.
+	// was closed or EOFed. This value loosely corresponds to VTIME in termios, which [Termios] ports
+	// implement in the kernel with no background goroutine. See Termios for how the semantics differ.
+	// Unlike [Mode.ReadTimeout] Read waits until b is filled and only returns less when the timeout elapses.
 	ReadTimeout time.Duration
 
 	// MaxReadSize determines the size of each individual read. If set to zero a suitable size will be chosen.
-	// This value loosely corresponds to VMIN in termios.
+	// This value loosely corresponds to VMIN in termios. Reads are never larger than the free space
+	// in the buffer so a MaxReadSize larger than MaxReadBuffered is effectively clamped to MaxReadBuffered.
 	MaxReadSize int
 
 	// MaxReadBuffered specifies the maximum amount of bytes to have buffered in our reader.
 	// After MaxReadBuffered is reached a NonBlocking will sleep until the caller has read bytes
 	// and made space for more reads. If set to zero a suitable size will be chosen.
 	MaxReadBuffered int
+
+	// Buffer is the storage for bytes read. If nil a fixed-capacity circular buffer
+	// of size MaxReadBuffered is used.
+	// See [Buffer] for the semantics required of custom implementations.
+	Buffer Buffer
+
+	// Logger is an optional hook called on NonBlocking events, useful for debugging.
+	// It is called outside of the NonBlocking lock so it is safe to perform I/O
+	// or call NonBlocking methods from within it. The events are:
+	//  - "read": data was read from the underlying reader. err is the error returned by the read, if any.
+	//  - "overrun": the buffer is full and the reader will stop reading until data is consumed.
+	//  - "timeout": a read deadline was exceeded with no data available.
+	//  - "error": the background reader terminated with err.
+	//  - "idle": keep-alive data was written after IdleInterval. err is the error returned by the write, if any.
+	// data is only valid for the duration of the call and must not be retained.
+	Logger func(event string, data []byte, err error)
+
+	// LazyStart defers starting the background read goroutine until the first call to Read or Buffered,
+	// or any method that calls them. Useful when opening many ports of which only a few are read.
+	// Until the goroutine is started no data is read from the underlying reader, so Buffered
+	// returns 0 on the first call in lazy mode.
+	LazyStart bool
+
+	// ReadFunc, if set, is called by the background goroutine to read data instead of the Read
+	// method of the ReadWriteCloser passed to NewNonBlocking. It allows injecting custom read behaviour,
+	// such as a per-read context or timeout, while keeping the buffering and timeout semantics of NonBlocking.
+	// ReadFunc must follow the io.Reader contract. Writes and Close still use the ReadWriteCloser.
+	ReadFunc func(b []byte) (int, error)
+
+	// MaxReadErrors is the amount of consecutive failed reads after which the background reader stops
+	// and the last read error is returned by Read. Read errors other than io.EOF and disconnection errors
+	// are considered transient and are retried with backoff until then. If set to zero 10 is used.
+	MaxReadErrors int
+
+	// IdleInterval, if non-zero, is the time without data being read after which the bytes returned
+	// by IdleFunc are written to the port, i.e. a keep-alive for devices that disconnect when idle.
+	// Keep-alives are repeated every IdleInterval while no data is read. They are written from
+	// a separate goroutine so that they are sent even while the underlying reader blocks, and
+	// are serialized with the caller's writes so they never interleave with them.
+	IdleInterval time.Duration
+	// IdleFunc returns the keep-alive bytes written after IdleInterval. It must be set if IdleInterval is.
+	// An empty return value skips the keep-alive.
+	IdleFunc func() []byte
+
+	// SoftwareFlowControl enables XON/XOFF flow control: received XOFF (0x13) and XON (0x11) bytes
+	// are removed from the read data and pause and resume writes, including keep-alives. A paused
+	// write blocks until XON is received, the reader terminates or Close is called. Writes already
+	// passed to the underlying port are not interrupted, so a single large Write may overrun a device
+	// that sends XOFF mid-write; when the driver supports it, flow control in the OS is more precise.
+	//
+	// SoftwareFlowControl must not be used with binary protocols where 0x11 and 0x13 are legitimate data:
+	// those bytes would be dropped from the data read and spuriously pause writes.
+	SoftwareFlowControl bool
+
+	// OnBackpressure, if set, is called by the background goroutine when the buffer becomes full with
+	// the amount of bytes buffered. The goroutine then stops reading until data is consumed, so data may be
+	// lost in the driver if the device keeps sending; the callback lets the caller react, i.e. by consuming
+	// faster or logging. It is called once each time the buffer fills, as the Logger "overrun" event,
+	// outside of the NonBlocking lock so it may call NonBlocking methods. It must not block for long
+	// since the goroutine does not read while it runs.
+	OnBackpressure func(buffered int)
 }
 
 // NewNonBlocking creates a [NonBlocking] instance with the given configuration parameters.
 // To manage the non-blocking behaviour NewNonBlocking creates a goroutine which lives until
-// the reader returns io.EOF or Close is called on NonBlocking.
+// the reader returns io.EOF or Close is called on NonBlocking. See NonBlockingConfig.LazyStart
+// to defer the creation of the goroutine.
 func NewNonBlocking(rwc io.ReadWriteCloser, cfg NonBlockingConfig) *NonBlocking {
+	nb := newNonBlocking(rwc, cfg)
+	if !cfg.LazyStart {
+		nb.start()
+	}
+	return nb
+}
+
+// NewNonBlockingPoll is like [NewNonBlocking] but the background goroutine blocks until the port is
+// readable using poll(2) on the port's file descriptor, instead of reading the port with an exponential
+// backoff while no data arrives. This eliminates the backoff's wakeups while idle and the latency
+// of up to 150ms it adds to the first bytes received after an idle period.
+//
+// It is only supported on Linux and for ports whose file descriptor is obtainable, see [FileDescriptor].
+// Otherwise NewNonBlockingPoll falls back to NewNonBlocking.
+func NewNonBlockingPoll(rwc io.ReadWriteCloser, cfg NonBlockingConfig) *NonBlocking {
+	fd, err := fileDescriptor(rwc)
+	if err == nil {
+		_, err = waitReadable(fd, 0)
+	}
+	if err != nil {
+		return NewNonBlocking(rwc, cfg)
+	}
+	read := cfg.ReadFunc
+	if read == nil {
+		read = rwc.Read
+	}
+	var nb *NonBlocking
+	cfg.ReadFunc = func(b []byte) (int, error) {
+		for nb.err() == nil {
+			// Wake up periodically to notice Close, which does not interrupt poll.
+			readable, err := waitReadable(fd, 100*time.Millisecond)
+			if err != nil || readable {
+				return read(b)
+			}
+		}
+		return 0, nil
+	}
+	nb = newNonBlocking(rwc, cfg)
+	if !cfg.LazyStart {
+		nb.start()
+	}
+	return nb
+}
+
+// newNonBlocking returns a NonBlocking with its reader not yet started.
+func newNonBlocking(rwc io.ReadWriteCloser, cfg NonBlockingConfig) *NonBlocking {
 	if rwc == nil {
 		panic("nil ReadWriteCloser passed into NewNonBlocking")
 	}
-	if cfg.ReadTimeout < 0 || cfg.MaxReadBuffered < 0 || cfg.MaxReadSize < 0 {
+	if cfg.ReadTimeout < 0 || cfg.MaxReadBuffered < 0 || cfg.MaxReadSize < 0 || cfg.MaxReadErrors < 0 ||
+		cfg.IdleInterval < 0 || (cfg.IdleInterval > 0 && cfg.IdleFunc == nil) {
 		panic("invalid argument to NewNonBlocking")
 	}
 	if cfg.MaxReadBuffered == 0 {
@@ -64,66 +262,358 @@ func NewNonBlocking(rwc io.ReadWriteCloser, cfg NonBlockingConfig) *NonBlocking
 	if cfg.MaxReadSize == 0 {
 		cfg.MaxReadSize = 1024 //
 	}
+	if cfg.Buffer == nil {
+		cfg.Buffer = newRing(cfg.MaxReadBuffered)
+	}
+	if cfg.MaxReadErrors == 0 {
+		cfg.MaxReadErrors = 10
+	}
+	if cfg.ReadFunc == nil {
+		cfg.ReadFunc = rwc.Read
+	}
 	nb := &NonBlocking{
 		io:             rwc,
+		read:           cfg.ReadFunc,
 		defaultTimeout: cfg.ReadTimeout,
 		maxBuffered:    cfg.MaxReadBuffered,
+		maxErrors:      cfg.MaxReadErrors,
+		buf:            cfg.Buffer,
+		logger:         cfg.Logger,
+		idleEvery:      cfg.IdleInterval,
+		idleFunc:       cfg.IdleFunc,
+		xonxoff:        cfg.SoftwareFlowControl,
+		onFull:         cfg.OnBackpressure,
+		done:           make(chan struct{}),
 	}
+	nb.readSize.Store(int64(cfg.MaxReadSize))
+	return nb
+}
 
-	go func(vmin int) {
-		defer func() {
-			// Goroutines can crash entire programs if they panic and are not recovered.
-			if r := recover(); r != nil {
-				nb.setErr(fmt.Errorf("panic in NonBlocking read goroutine: %v", r))
-			}
-		}()
-		backoff := exponentialBackoff{
-			MaxWait:   150 * time.Millisecond,
-			StartWait: 1 * time.Nanosecond,
+// NewNonBlockingReader creates a [NonBlocking] that buffers data read from r, which need not be a port,
+// i.e. a read-only pipe or file. Passing an already buffered reader such as a [bufio.Reader] adds a second
+// buffer whose data is not reported by Buffered, see [EffectiveBuffered]; prefer passing the raw reader.
+// Writes return [ErrNotWritable]. Close does not close r: it stops the background goroutine once its read
+// in progress returns, after which the NonBlocking reports io.EOF.
+func NewNonBlockingReader(r io.Reader, cfg NonBlockingConfig) *NonBlocking {
+	if r == nil {
+		panic("nil Reader passed into NewNonBlockingReader")
+	}
+	return NewNonBlocking(readOnly{r}, cfg)
+}
+
+// readOnly adapts an io.Reader to an io.ReadWriteCloser that can't be written and does not close the reader.
+type readOnly struct {
+	io.Reader
+}
+
+func (readOnly) Write([]byte) (int, error) { return 0, ErrNotWritable }
+func (readOnly) Close() error              { return nil }
+
+// start starts the background read goroutine if not already started.
+func (nb *NonBlocking) start() {
+	nb.startOnce.Do(func() {
+		if nb.poller != nil {
+			nb.poller.schedule(nb)
+		} else {
+			go nb.readLoop()
 		}
-		buf := make([]byte, vmin)
-		for nb.err() == nil {
-			if nb.maxBuffered != 0 && nb.Buffered() >= nb.maxBuffered {
-				// Our buffer is full, sleep until the caller has read bytes.
-				backoff.Miss()
-				continue
-			}
-			n, err := nb.io.Read(buf[:])
-			nb.bufwrite(buf[:n])
-			if err != nil && errors.Is(err, io.EOF) {
-				nb.setErr(err) // Our Reader is done. Nothing more to do here.
-				return
-			}
-			if n == 0 {
-				// An empty read is a good indicator that nothing much is happening on bus, so sleep.
-				backoff.Miss()
-				continue
+		if nb.idleEvery > 0 {
+			nb.mu.Lock()
+			nb.lastData = time.Now()
+			nb.mu.Unlock()
+			go nb.idleLoop()
+		}
+	})
+}
+
+// idleLoop writes keep-alive data when no data has been read for the idle interval.
+// It returns once the background reader terminates.
+func (nb *NonBlocking) idleLoop() {
+	for {
+		nb.mu.Lock()
+		next := nb.lastData.Add(nb.idleEvery)
+		done := nb.errfield != nil
+		nb.mu.Unlock()
+		if done {
+			return
+		}
+		if until := time.Until(next); until > 0 {
+			// Wake up periodically to notice the reader terminating.
+			time.Sleep(minD(until, 100*time.Millisecond))
+			continue
+		}
+		data := nb.idleFunc()
+		if len(data) > 0 {
+			nb.wmu.Lock()
+			nb.waitXON()
+			_, err := nb.io.Write(data)
+			nb.wmu.Unlock()
+			nb.log("idle", data, err)
+		}
+		nb.mu.Lock()
+		if nb.lastData.Before(next) {
+			nb.lastData = time.Now()
+		}
+		nb.mu.Unlock()
+	}
+}
+
+// readLoop reads from the underlying reader into the buffer until the reader fails or NonBlocking is closed.
+func (nb *NonBlocking) readLoop() {
+	defer nb.readerDone()
+	defer nb.recoverReader()
+	st := newReadState()
+	for {
+		wait, done := nb.readStep(st)
+		if done {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// recoverReader must be deferred by the goroutine driving the reader. Goroutines can crash
+// entire programs if they panic and are not recovered, so the reader's panics are recovered
+// and reported by Read, terminating the reader.
+func (nb *NonBlocking) recoverReader() {
+	if r := recover(); r != nil {
+		nb.setErr(fmt.Errorf("%w: %v\n%s", ErrReaderPanicked, r, debug.Stack()))
+	}
+}
+
+// readerDone signals the reader has terminated.
+func (nb *NonBlocking) readerDone() {
+	nb.log("error", nil, nb.err())
+	close(nb.done)
+}
+
+// readState is the state of the background reader kept between reads.
+type readState struct {
+	backoff           exponentialBackoff
+	buf               []byte
+	overrun           bool
+	consecutiveErrors int
+}
+
+func newReadState() *readState {
+	return &readState{backoff: exponentialBackoff{
+		MaxWait:   150 * time.Millisecond,
+		StartWait: 1 * time.Nanosecond,
+	}}
+}
+
+// readStep performs a single read from the underlying reader into the buffer.
+// It returns the time to wait before the next step or done if the reader terminated.
+func (nb *NonBlocking) readStep(st *readState) (wait time.Duration, done bool) {
+	if nb.err() != nil {
+		return 0, true
+	}
+	free, readSize := nb.readLimits()
+	if len(st.buf) != readSize {
+		st.buf = make([]byte, readSize)
+	}
+	if free > len(st.buf) {
+		free = len(st.buf)
+	}
+	if free > 0 {
+		free = nb.reserveRead(free)
+	}
+	if free <= 0 {
+		// Our buffer is full, sleep until the caller has read bytes.
+		if !st.overrun {
+			nb.log("overrun", nil, nil)
+			if nb.onFull != nil {
+				nb.onFull(int(nb.buffered.Load()))
 			}
-			backoff.Hit()
+			st.overrun = true
 		}
-	}(cfg.MaxReadSize)
-	return nb
+		return nb.backoffMiss(&st.backoff), false
+	}
+	st.overrun = false
+	n, err := nb.read(st.buf[:free])
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// The read timeout of the port, i.e. ErrReadTimeout, passed: not an error.
+		err = nil
+	}
+	if werr := nb.bufwrite(st.buf[:n]); werr != nil && err == nil {
+		err = werr
+	}
+	if n > 0 || err != nil {
+		nb.log("read", st.buf[:n], err)
+	}
+	if err != nil && errors.Is(err, io.EOF) {
+		nb.setErr(err) // Our Reader is done. Nothing more to do here.
+		return 0, true
+	} else if err != nil && isDisconnectErr(err) {
+		nb.setErr(fmt.Errorf("%w: %w", ErrPortDisconnected, err))
+		return 0, true
+	} else if err != nil {
+		st.consecutiveErrors++
+		if st.consecutiveErrors >= nb.maxErrors {
+			nb.setErr(err) // Error is persistent, give up.
+			return 0, true
+		}
+		return nb.backoffMiss(&st.backoff), false
+	}
+	st.consecutiveErrors = 0
+	if n == 0 {
+		// An empty read is a good indicator that nothing much is happening on bus, so sleep.
+		return nb.backoffMiss(&st.backoff), false
+	}
+	st.backoff.Hit()
+	return 0, false
+}
+
+// SetMaxReadSize sets the size of each individual read performed by the background goroutine.
+// It takes effect on the next read. Large values allow for faster bulk transfers while small values
+// reduce the latency of data becoming available to Read since the underlying reader may wait
+// to fill the read before returning, depending on the implementation. SetMaxReadSize panics if n <= 0.
+func (nb *NonBlocking) SetMaxReadSize(n int) {
+	if n <= 0 {
+		panic("invalid read size")
+	}
+	nb.readSize.Store(int64(n))
+}
+
+// reserveRead reserves up to n bytes of free buffer space for the read about to be performed
+// and returns the amount reserved. The space is released by bufwrite. While the read is in progress
+// Unread can't use the reserved space so the bytes read always fit in the buffer.
+func (nb *NonBlocking) reserveRead(n int) int {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if free := nb.maxBuffered - nb.buf.Len(); n > free {
+		n = free
+	}
+	nb.reserved = n
+	return n
+}
+
+// readLimits returns the free space in the buffer and the configured read size,
+// which is clamped to the maximum buffered so read buffers are never larger than needed.
+func (nb *NonBlocking) readLimits() (free, readSize int) {
+	readSize = int(nb.readSize.Load())
+	if readSize > nb.maxBuffered {
+		readSize = nb.maxBuffered
+	}
+	return nb.maxBuffered - int(nb.buffered.Load()), readSize
 }
 
 // Write implements the [io.Writer] interface. Sends writes directly to the underlying Writer.
+//
+// Write performs a single call to the underlying Writer. Some serial port implementations return
+// after writing only part of b, so Write is not atomic across goroutines: bytes from concurrent
+// Write calls may end up interleaved on the wire. Use [NonBlocking.WriteFrame] when frames must not be split.
 func (nb *NonBlocking) Write(b []byte) (int, error) {
+	nb.wmu.Lock()
+	defer nb.wmu.Unlock()
+	nb.waitXON()
+	if nb.isClosed() {
+		return 0, ErrClosed
+	}
 	return nb.io.Write(b)
 }
 
+// WriteFrame writes all of b to the underlying Writer, retrying on short writes, while holding the write lock
+// so that no other Write, WriteString or WriteFrame call from a concurrent goroutine interleaves with the frame.
+func (nb *NonBlocking) WriteFrame(b []byte) (n int, err error) {
+	nb.wmu.Lock()
+	defer nb.wmu.Unlock()
+	if nb.isClosed() {
+		return 0, ErrClosed
+	}
+	for n < len(b) && err == nil {
+		var nn int
+		nb.waitXON()
+		nn, err = nb.io.Write(b[n:])
+		n += nn
+		if nn == 0 && err == nil {
+			err = io.ErrShortWrite
+		}
+	}
+	return n, err
+}
+
+// WriteString implements the [io.StringWriter] interface. If the underlying Writer implements
+// io.StringWriter the string is passed through directly, avoiding a []byte conversion allocation.
+func (nb *NonBlocking) WriteString(s string) (int, error) {
+	nb.wmu.Lock()
+	defer nb.wmu.Unlock()
+	nb.waitXON()
+	if nb.isClosed() {
+		return 0, ErrClosed
+	}
+	return io.WriteString(nb.io, s)
+}
+
+// ReadFrom implements the [io.ReaderFrom] interface. It writes data read from r to
+// the NonBlocking until r returns io.EOF or an error.
+func (nb *NonBlocking) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{nb}, r)
+}
+
+// WriteTo implements the [io.WriterTo] interface. It writes buffered and newly read data to w
+// until the bus is idle for the configured read timeout or the reader terminates.
+// An idle bus and an io.EOF from the reader are not considered errors and WriteTo
+// returns a nil error in those cases. If the read timeout is zero WriteTo returns once the
+// buffer has been drained.
+func (nb *NonBlocking) WriteTo(w io.Writer) (n int64, err error) {
+	buf := make([]byte, 1024)
+	for {
+		nr, rerr := nb.Read(buf)
+		if nr > 0 {
+			nw, werr := w.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			} else if nw != nr {
+				return n, io.ErrShortWrite
+			}
+			continue // Keep on draining buffer even if reader has terminated.
+		}
+		if rerr == nil || rerr == errDeadlineExceeded || errors.Is(rerr, io.EOF) {
+			return n, nil
+		}
+		return n, rerr
+	}
+}
+
 // Read implements the [io.Reader] interface. Will call NonBlocking.ReadDeadline with the set timeout.
+//
+// If the timeout is zero Read copies whatever is buffered into b and returns immediately.
+// If len(b) is larger than the amount buffered the partial read is returned with no error;
+// the error is only non-nil when the background reader has terminated.
+// Bytes are copied once from the internal buffer directly into b.
+//
+// Timeouts and terminal errors are told apart with errors.Is: a timeout satisfies
+// errors.Is(err, os.ErrDeadlineExceeded) and the Read may be retried later while
+// io.EOF means the NonBlocking was closed or the reader finished. Any other error
+// means the reader failed, i.e. [ErrPortDisconnected]. Terminal errors are sticky and
+// are only returned once all buffered data has been read.
 func (nb *NonBlocking) Read(b []byte) (int, error) {
-	if nb.defaultTimeout == 0 {
+	nb.start()
+	nb.mu.Lock()
+	timeout := nb.defaultTimeout
+	if timeout == 0 {
 		// Fast track for no-timeouts configuration.
-		nb.mu.Lock()
 		defer nb.mu.Unlock()
 		n, _ := nb.buf.Read(b)
-		return n, nb.errfield
+		nb.syncBuffered()
+		if n > 0 {
+			return n, nil // Buffered data is always handed out before the reader's error.
+		}
+		return 0, nb.errfield
 	}
-	deadline := time.Now().Add(nb.defaultTimeout)
+	nb.mu.Unlock()
+	deadline := time.Now().Add(timeout)
 	return nb.ReadDeadline(b, deadline)
 }
 
-// ReadDeadline reads from the underlying buffer up until the deadline.
+// ReadDeadline reads into b until b is full, the deadline passes or the background reader fails.
+// If any bytes were read they are returned with a nil error, even if the deadline passed
+// or the reader failed while reading; the error is then reported by the next call.
+// If no bytes were read the error is a timeout error if the deadline passed or the
+// reader's error otherwise, i.e. io.EOF after Close. No data is lost on timeout:
+// bytes that arrive after the deadline remain buffered for the next call.
 func (nb *NonBlocking) ReadDeadline(b []byte, deadline time.Time) (n int, err error) {
 	for err == nil && n < len(b) {
 		var nn int
@@ -141,41 +631,243 @@ func (nb *NonBlocking) ReadDeadline(b []byte, deadline time.Time) (n int, err er
 	return n, err
 }
 
+// ReadTimed reads into b as [NonBlocking.ReadDeadline] does and also returns how long the call waited
+// before returning data or timing out. Recording waited for reads that succeed is a simple way of
+// sizing deadlines empirically, i.e. to a margin above the longest wait observed for a device's responses.
+func (nb *NonBlocking) ReadTimed(b []byte, deadline time.Time) (n int, waited time.Duration, err error) {
+	start := time.Now()
+	n, err = nb.ReadDeadline(b, deadline)
+	return n, time.Since(start), err
+}
+
+// ReadAtLeast reads into b until at least min bytes have been read, mirroring [io.ReadAtLeast] but
+// waiting no later than the deadline. It returns as soon as min bytes are read, without waiting to fill b.
+// If fewer than min bytes were read by the deadline they are returned along with a timeout error.
+// If the reader fails with io.EOF after some but not min bytes were read the error is io.ErrUnexpectedEOF.
+// If min is greater than the length of b io.ErrShortBuffer is returned.
+func (nb *NonBlocking) ReadAtLeast(b []byte, min int, deadline time.Time) (n int, err error) {
+	if len(b) < min {
+		return 0, io.ErrShortBuffer
+	}
+	for n < min && err == nil {
+		var nn int
+		nn, err = nb.readNext(b[n:], deadline)
+		n += nn
+	}
+	if n >= min {
+		err = nil
+	} else if n > 0 && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// ReadIdle reads into b until the bus has been idle for the idle duration, b is full or the timeout
+// expires, whichever happens first. The idle period starts when ReadIdle is called and restarts
+// each time data is received, mirroring the VMIN=0, VTIME>0 termios read mode. It is useful to read
+// a response of unknown length. If no data is received a timeout error is returned. ReadIdle panics if idle <= 0.
+func (nb *NonBlocking) ReadIdle(b []byte, idle, timeout time.Duration) (n int, err error) {
+	if idle <= 0 {
+		panic("invalid idle duration")
+	}
+	return nb.readUntilIdle(b, idle, timeout, false)
+}
+
+// ReadInterByte reads into b until no byte has been received for the interByte duration after
+// the previous one, b is full or the overall timeout expires, whichever happens first. Unlike [NonBlocking.ReadIdle]
+// the inter-byte timer only starts once the first byte is received, mirroring the VMIN>0, VTIME>0
+// termios read mode, so ReadInterByte waits up to the overall timeout for a response to begin.
+// It is the usual way of framing variable-length responses on RS-232. If no data is received
+// a timeout error is returned. ReadInterByte panics if interByte <= 0.
+func (nb *NonBlocking) ReadInterByte(b []byte, interByte, overall time.Duration) (n int, err error) {
+	if interByte <= 0 {
+		panic("invalid inter-byte duration")
+	}
+	return nb.readUntilIdle(b, interByte, overall, true)
+}
+
+// AppendRead waits until data is buffered or the deadline passes and appends all buffered bytes to dst,
+// growing it as needed, and returns the extended slice. Reusing dst's backing array across calls, i.e.
+// by passing dst[:0] after processing, avoids allocating in hot loops. Errors are reported as by
+// [NonBlocking.ReadDeadline]: if no bytes were appended dst is returned unmodified along with the error.
+func (nb *NonBlocking) AppendRead(dst []byte, deadline time.Time) ([]byte, error) {
+	err := nb.waitData(deadline)
+	if err != nil {
+		return dst, err
+	}
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	n := nb.buf.Len()
+	dst = append(dst, make([]byte, n)...)
+	nb.buf.Read(dst[len(dst)-n:])
+	nb.syncBuffered()
+	return dst, nil
+}
+
+// readUntilIdle implements ReadIdle and ReadInterByte. If waitFirst is set the idle period
+// starts once the first byte is received instead of immediately.
+func (nb *NonBlocking) readUntilIdle(b []byte, idle, timeout time.Duration, waitFirst bool) (n int, err error) {
+	deadline := time.Now().Add(timeout)
+	idleEnd := time.Now().Add(idle)
+	for n < len(b) {
+		wait := deadline
+		if n > 0 || !waitFirst {
+			wait = minTime(idleEnd, deadline)
+		}
+		var nn int
+		nn, err = nb.readNext(b[n:], wait)
+		if nn > 0 {
+			n += nn
+			idleEnd = time.Now().Add(idle)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, err
+}
+
+// Transact discards any unread input, writes req and reads the response until and including the
+// first respDelim byte received, or until the timeout expires. Discarding unread input first
+// avoids a late response to a previous request being mistaken for the response to req.
+// Bytes received after respDelim are left buffered. If the timeout expires before respDelim
+// is received the partial response is returned along with a timeout error.
+func (nb *NonBlocking) Transact(req []byte, respDelim byte, timeout time.Duration) (resp []byte, err error) {
+	deadline := time.Now().Add(timeout)
+	nb.Reset()
+	_, err = nb.WriteFrame(req)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = nb.waitData(deadline)
+		if err != nil {
+			return resp, err
+		}
+		var found bool
+		resp, found = nb.appendUntil(resp, respDelim)
+		if found {
+			return resp, nil
+		}
+	}
+}
+
+// appendUntil appends buffered bytes to dst until and including delim, which is reported by found.
+func (nb *NonBlocking) appendUntil(dst []byte, delim byte) (_ []byte, found bool) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	defer nb.syncBuffered()
+	var c [1]byte
+	for nb.buf.Len() > 0 {
+		nb.buf.Read(c[:])
+		dst = append(dst, c[0])
+		if c[0] == delim {
+			return dst, true
+		}
+	}
+	return dst, false
+}
+
 func (nb *NonBlocking) readNext(b []byte, deadline time.Time) (int, error) {
-	n := nb.Buffered()
-	for n <= 0 {
+	err := nb.waitData(deadline)
+	if err != nil {
+		return 0, err
+	}
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.buf.Len() == 0 {
+		// There was a race to read buf and we lost.
+		// This can happen if there are multiple callers to ReadDeadline.
+		return 0, nil
+	}
+	// We ignore io.EOF returned by buffer since unless goroutine is done it is not really EOF.
+	n, _ := nb.buf.Read(b)
+	nb.syncBuffered()
+	return n, nil
+}
+
+// waitData waits until there is buffered data. It returns an error if the deadline passes
+// or the reader fails before data is buffered.
+func (nb *NonBlocking) waitData(deadline time.Time) error {
+	return nb.WaitFor(1, deadline)
+}
+
+// WaitFor blocks until at least n bytes are buffered or the deadline passes, without consuming
+// any data. It is useful for fixed-length protocols: once WaitFor returns nil a single Read
+// of n bytes returns the whole response. WaitFor returns a timeout error if the deadline passes
+// and the reader's error if it fails before n bytes are buffered. If n is greater than
+// the maximum amount of buffered data io.ErrShortBuffer is returned.
+func (nb *NonBlocking) WaitFor(n int, deadline time.Time) error {
+	if n > nb.maxBuffered {
+		return io.ErrShortBuffer
+	}
+	for nb.Buffered() < n {
 		until := time.Until(deadline)
 		if until < 0 {
-			return 0, errDeadlineExceeded
+			nb.log("timeout", nil, errDeadlineExceeded)
+			return errDeadlineExceeded
 		} else if err := nb.err(); err != nil {
-			return 0, err // Our reader failed, no recovery so just exit.
+			return err // Our reader failed, no recovery so just exit.
 		}
 		time.Sleep(minD(100*time.Millisecond, until))
-		n = nb.Buffered()
 	}
+	return nil
+}
+
+// readBuffered reads buffered data into b without waiting. If there is no data
+// buffered it returns the reader's error, which is nil if the reader is still running.
+func (nb *NonBlocking) readBuffered(b []byte) (int, error) {
+	nb.start()
 	nb.mu.Lock()
 	defer nb.mu.Unlock()
 	if nb.buf.Len() == 0 {
-		// There was a race to read buf and we lost.
-		// This can happen if there are multiple callers to ReadDeadline.
-		return 0, nil
+		return 0, nb.errfield
 	}
-	// We ignore io.EOF returned by buffer since unless goroutine is done it is not really EOF.
-	n, _ = nb.buf.Read(b)
+	n, _ := nb.buf.Read(b)
+	nb.syncBuffered()
 	return n, nil
 }
 
 // Buffered returns the amount of bytes in the underlying buffer.
 func (nb *NonBlocking) Buffered() int {
-	nb.mu.Lock()
-	defer nb.mu.Unlock()
-	return nb.buf.Len()
+	nb.start()
+	return int(nb.buffered.Load())
 }
 
-// Close terminates to reader and writer. Sets [io.EOF] as the returned error for future Read calls.
+// Close terminates to reader and writer. Sets [io.EOF] as the returned error for future Read calls
+// and [ErrClosed] for future writes.
+// Close is idempotent and safe for concurrent use: the underlying port is closed only once
+// and subsequent calls return the error of the first call.
 func (nb *NonBlocking) Close() error {
-	nb.setErr(io.EOF)
-	return nb.io.Close()
+	nb.closeOnce.Do(func() {
+		nb.mu.Lock()
+		nb.errfield = io.EOF
+		nb.closed = true
+		nb.resumeWrites()
+		nb.mu.Unlock()
+		nb.closeErr = nb.io.Close()
+		// If the background goroutine was never started there is nothing to wait for.
+		nb.startOnce.Do(func() { close(nb.done) })
+	})
+	return nb.closeErr
+}
+
+// Done returns a channel that is closed when the background read goroutine exits, after which
+// no more data is buffered. The goroutine exits when the reader fails, i.e. with io.EOF or a panic,
+// or after Close once the read in progress returns. The reason is returned by Read once the
+// buffered data is consumed. Done is useful to supervise and reopen disconnected ports.
+func (nb *NonBlocking) Done() <-chan struct{} {
+	return nb.done
+}
+
+// Underlying returns the wrapped port. It is an escape hatch to access backend specific functionality.
+// Reading from the returned port bypasses the NonBlocking buffer and competes with the background
+// read goroutine for data, so it should only be used for configuration and control.
+func (nb *NonBlocking) Underlying() io.ReadWriteCloser {
+	return nb.io
 }
 
 // Reset resets the underlying buffer to be empty, discarding all data read.
@@ -185,6 +877,74 @@ func (nb *NonBlocking) Reset() {
 	nb.mu.Lock()
 	defer nb.mu.Unlock()
 	nb.buf.Reset()
+	nb.syncBuffered()
+}
+
+// Snapshot returns a copy of all currently buffered bytes without consuming them, i.e. to log
+// the data received so far when parsing a frame fails. It does not wait for data.
+// Custom Buffers other than [bytes.Buffer] are snapshotted by reading all their
+// data and writing it back, see [Buffer].
+func (nb *NonBlocking) Snapshot() []byte {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	data := make([]byte, nb.buf.Len())
+	switch buf := nb.buf.(type) {
+	case *ring:
+		buf.peek(data)
+	case interface{ Bytes() []byte }:
+		copy(data, buf.Bytes())
+	default:
+		// The buffer is empty after reading so writing back preserves the order.
+		n, _ := io.ReadFull(buf, data)
+		data = data[:n]
+		buf.Write(data)
+		nb.syncBuffered()
+	}
+	return data
+}
+
+// Unread puts b back at the front of the buffer so that the next read returns it before any other
+// buffered data, i.e. for parsers that need to backtrack after consuming too much. The maximum amount
+// of bytes that can be put back is the free space in the buffer, MaxReadBuffered minus [NonBlocking.Buffered],
+// less the space reserved for the bytes of a read from the port in progress; if b does not fit
+// io.ErrShortBuffer is returned and nothing is put back. Put back bytes count towards
+// MaxReadBuffered so they delay the background reader if the buffer becomes full.
+// b need not have been read from the NonBlocking.
+func (nb *NonBlocking) Unread(b []byte) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if len(b) > nb.maxBuffered-nb.buf.Len()-nb.reserved {
+		return io.ErrShortBuffer
+	}
+	if r, ok := nb.buf.(*ring); ok {
+		r.unread(b)
+	} else {
+		// Custom Buffers only append so rewrite the buffer with b first.
+		data := make([]byte, nb.buf.Len())
+		n, _ := io.ReadFull(nb.buf, data)
+		nb.buf.Write(b)
+		nb.buf.Write(data[:n])
+	}
+	nb.syncBuffered()
+	return nil
+}
+
+// DiscardFor discards all buffered data and keeps discarding all data read during the duration d,
+// blocking until d has elapsed. This is useful to ignore noise a device emits during a settle period,
+// for example boot messages after a reset, so that subsequent calls to Read start clean.
+func (nb *NonBlocking) DiscardFor(d time.Duration) {
+	nb.start()
+	nb.mu.Lock()
+	nb.discardUntil = time.Now().Add(d)
+	nb.buf.Reset()
+	nb.syncBuffered()
+	nb.mu.Unlock()
+	time.Sleep(d)
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	nb.discardUntil = time.Time{}
+	nb.buf.Reset() // Bytes may have been written at the very end of the discard window.
+	nb.syncBuffered()
 }
 
 // err returns error set by setErr. If err is set read goroutine is done or in process of ending.
@@ -194,16 +954,193 @@ func (nb *NonBlocking) err() error {
 	return nb.errfield
 }
 
+// isClosed reports whether Close was called.
+func (nb *NonBlocking) isClosed() bool {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	return nb.closed
+}
+
+// setErr sets the reader's error. The first error is kept so that a read failing
+// because of Close does not replace the io.EOF set by Close.
 func (nb *NonBlocking) setErr(err error) {
 	nb.mu.Lock()
 	defer nb.mu.Unlock()
-	nb.errfield = err
+	if nb.errfield == nil {
+		nb.errfield = err
+	}
+	nb.resumeWrites()
 }
 
-func (nb *NonBlocking) bufwrite(b []byte) {
+// log calls the configured Logger, if any. Must not be called with the lock held.
+func (nb *NonBlocking) log(event string, data []byte, err error) {
+	if nb.logger != nil {
+		nb.logger(event, data, err)
+	}
+}
+
+// Stats returns a snapshot of the background reader counters.
+func (nb *NonBlocking) Stats() NonBlockingStats {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	return nb.stats
+}
+
+// bufwrite stores the result of a read from the underlying reader.
+func (nb *NonBlocking) bufwrite(b []byte) error {
 	nb.mu.Lock()
 	defer nb.mu.Unlock()
-	nb.buf.Write(b)
+	nb.reserved = 0
+	nb.stats.Reads++
+	nb.stats.BytesRead += uint64(len(b))
+	if len(b) == 0 {
+		nb.stats.EmptyReads++
+		return nil
+	}
+	nb.lastData = time.Now()
+	if nb.xonxoff {
+		b = nb.flowControl(b)
+	}
+	if !nb.discardUntil.IsZero() && time.Now().Before(nb.discardUntil) {
+		return nil // Discarding data, see DiscardFor.
+	}
+	_, err := nb.buf.Write(b)
+	nb.syncBuffered()
+	return err
+}
+
+// flowControl returns b without XON and XOFF bytes, pausing or resuming writes
+// according to the last one received. Must be called with mu held.
+func (nb *NonBlocking) flowControl(b []byte) []byte {
+	const (
+		xon  = 0x11
+		xoff = 0x13
+	)
+	if bytes.IndexByte(b, xon) < 0 && bytes.IndexByte(b, xoff) < 0 {
+		return b
+	}
+	// b is not modified since it is passed to the Logger after being buffered.
+	data := make([]byte, 0, len(b))
+	for _, c := range b {
+		switch c {
+		case xoff:
+			if nb.xon == nil && nb.errfield == nil {
+				nb.xon = make(chan struct{})
+			}
+		case xon:
+			nb.resumeWrites()
+		default:
+			data = append(data, c)
+		}
+	}
+	return data
+}
+
+// resumeWrites releases writes paused by XOFF. Must be called with mu held.
+func (nb *NonBlocking) resumeWrites() {
+	if nb.xon != nil {
+		close(nb.xon)
+		nb.xon = nil
+	}
+}
+
+// waitXON blocks while writes are paused by XOFF. Must be called with wmu held.
+func (nb *NonBlocking) waitXON() {
+	if !nb.xonxoff {
+		return
+	}
+	nb.mu.Lock()
+	xon := nb.xon
+	nb.mu.Unlock()
+	if xon != nil {
+		<-xon
+	}
+}
+
+// syncBuffered updates the atomic buffered length after buf is modified. Must be called with mu held.
+func (nb *NonBlocking) syncBuffered() {
+	nb.buffered.Store(int64(nb.buf.Len()))
+}
+
+// backoffMiss registers a miss in backoff and returns the time to sleep before the next read.
+func (nb *NonBlocking) backoffMiss(backoff *exponentialBackoff) time.Duration {
+	nb.mu.Lock()
+	nb.stats.BackoffSleeps++
+	nb.mu.Unlock()
+	return backoff.Next()
+}
+
+// ReadFullDeadline reads exactly len(b) bytes from r into b, mirroring [io.ReadFull] but waiting no later
+// than the deadline. Unlike a single ReadDeadline call it keeps reading across the chunks buffered by
+// the background reader until b is full. If b is not filled by the deadline the bytes read are
+// returned along with a timeout error; those bytes are consumed. If the reader fails with io.EOF
+// after some but not all bytes were read the error is io.ErrUnexpectedEOF.
+// This is the natural primitive for fixed-size frames.
+func ReadFullDeadline(r *NonBlocking, b []byte, deadline time.Time) (int, error) {
+	return r.ReadAtLeast(b, len(b), deadline)
+}
+
+// EffectiveBuffered returns the amount of bytes buffered by r and the readers it wraps, which helps diagnose
+// latency when buffers are stacked, i.e. a [NonBlocking] reading from a [bufio.Reader]: bytes held by the
+// bufio.Reader are not returned by the NonBlocking's Buffered although they are already received.
+// Readers implementing `Buffered() int`, such as NonBlocking and bufio.Reader, are counted. Wrapped readers
+// are followed through their `Underlying() io.ReadWriteCloser` method and into the reader passed
+// to [NewNonBlockingReader]. Data buffered by the OS is not counted.
+func EffectiveBuffered(r io.Reader) int {
+	n := 0
+	for {
+		if b, ok := r.(interface{ Buffered() int }); ok {
+			n += b.Buffered()
+		}
+		switch u := r.(type) {
+		case underlyingPort:
+			r = u.Underlying()
+		case readOnly:
+			r = u.Reader
+		default:
+			return n
+		}
+	}
+}
+
+// CopyUntilIdle copies data read from src to dst until no data has been received for the idle duration
+// or src's reader terminates. It returns the amount of bytes copied. An idle bus or io.EOF
+// are not considered errors. CopyUntilIdle is useful to read a response of unknown length.
+func CopyUntilIdle(dst io.Writer, src *NonBlocking, idle time.Duration) (n int64, err error) {
+	if idle <= 0 {
+		panic("invalid idle duration")
+	}
+	buf := make([]byte, 1024)
+	for {
+		nr, rerr := src.readNext(buf, time.Now().Add(idle))
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			} else if nw != nr {
+				return n, io.ErrShortWrite
+			}
+			continue
+		}
+		if rerr == errDeadlineExceeded || errors.Is(rerr, io.EOF) {
+			return n, nil
+		} else if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// writerOnly hides io.ReaderFrom implementation of a Writer so io.Copy does not recurse.
+type writerOnly struct {
+	io.Writer
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
 }
 
 func minD(a, b time.Duration) time.Duration {
@@ -237,8 +1174,8 @@ func (eb *exponentialBackoff) Hit() {
 	eb.Wait = eb.StartWait
 }
 
-// Miss sleeps for eb.Wait and increases eb.Wait exponentially.
-func (eb *exponentialBackoff) Miss() {
+// Next returns the current eb.Wait, the time to sleep after a miss, and increases eb.Wait exponentially.
+func (eb *exponentialBackoff) Next() time.Duration {
 	const k = 1
 	wait := eb.Wait
 	maxWait := eb.MaxWait
@@ -246,11 +1183,12 @@ func (eb *exponentialBackoff) Miss() {
 	if maxWait == 0 {
 		panic("MaxWait cannot be zero")
 	}
-	time.Sleep(wait)
+	current := wait
 	wait |= time.Duration(k)
 	wait <<= exp
 	if wait > maxWait {
 		wait = maxWait
 	}
 	eb.Wait = wait
+	return current
 }
@@ -0,0 +1,179 @@
+package cereal
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// PipeConfig configures the line conditions simulated by a pipe created with [NewPipe].
+// The zero value is an ideal line with no delay or errors.
+type PipeConfig struct {
+	// ByteDelay is the time each byte takes to cross the pipe. Bytes are delivered one after the other
+	// so a write of n bytes is fully readable n*ByteDelay after being written, or later if previously
+	// written bytes are still in transit. Use [Mode.TransmitDuration] to emulate a baud rate.
+	ByteDelay time.Duration
+	// BitErrorRate is the probability of each bit written being flipped, between 0 and 1.
+	BitErrorRate float64
+	// DropRate is the probability of each byte written being lost, between 0 and 1.
+	DropRate float64
+	// Seed seeds the random source used to corrupt and drop bytes so that tests are deterministic.
+	Seed int64
+}
+
+// Pipe returns two connected in-memory ports: bytes written to a are read from b and bytes written to b
+// are read from a. It is useful for tests, i.e. running a fake device on one end and a client on the other.
+//
+// Like a serial port and unlike [net.Pipe], writes are buffered and return immediately
+// while reads block until data is available, as a port with no read timeout does. Wrap an end in
+// a [NonBlocking] for timeout semantics. Closing either end closes the pipe: pending and
+// subsequent reads on the other end return io.EOF once buffered data is read and writes
+// to either end return io.ErrClosedPipe. Both ends are safe for concurrent use.
+func Pipe() (a, b io.ReadWriteCloser) {
+	return NewPipe(PipeConfig{})
+}
+
+// NewPipe returns a [Pipe] simulating the line conditions in cfg, i.e. to test that framing
+// and checksum handling recovers from corrupted and lost bytes. Each direction is
+// affected independently.
+func NewPipe(cfg PipeConfig) (a, b io.ReadWriteCloser) {
+	if cfg.ByteDelay < 0 || cfg.BitErrorRate < 0 || cfg.BitErrorRate > 1 || cfg.DropRate < 0 || cfg.DropRate > 1 {
+		panic("invalid argument to NewPipe")
+	}
+	ab := newPipeBuffer(cfg, cfg.Seed)
+	ba := newPipeBuffer(cfg, cfg.Seed+1)
+	return &pipeEnd{r: ba, w: ab}, &pipeEnd{r: ab, w: ba}
+}
+
+// pipeEnd is one end of a Pipe. It reads from r and writes to w.
+type pipeEnd struct {
+	r, w *pipeBuffer
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) { return p.r.read(b) }
+
+func (p *pipeEnd) Write(b []byte) (int, error) { return p.w.write(b) }
+
+func (p *pipeEnd) Close() error {
+	p.r.close()
+	p.w.close()
+	return nil
+}
+
+// pipeBuffer is a unidirectional buffered pipe.
+type pipeBuffer struct {
+	cfg    PipeConfig
+	rng    *rand.Rand
+	mu     sync.Mutex
+	cond   sync.Cond
+	buf    bytes.Buffer
+	closed bool
+	// transit holds the bytes written but not yet delivered when ByteDelay is set.
+	// The first byte in transit is delivered at next and the following bytes ByteDelay apart.
+	transit []byte
+	next    time.Time
+}
+
+func newPipeBuffer(cfg PipeConfig, seed int64) *pipeBuffer {
+	pb := &pipeBuffer{cfg: cfg, rng: rand.New(rand.NewSource(seed))}
+	pb.cond.L = &pb.mu
+	return pb
+}
+
+func (pb *pipeBuffer) read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for {
+		pb.deliver()
+		if pb.buf.Len() > 0 {
+			return pb.buf.Read(b)
+		} else if len(pb.transit) > 0 {
+			// Wake up when the next byte arrives.
+			timer := time.AfterFunc(time.Until(pb.next), func() {
+				pb.mu.Lock()
+				defer pb.mu.Unlock()
+				pb.cond.Broadcast()
+			})
+			pb.cond.Wait()
+			timer.Stop()
+		} else if pb.closed {
+			return 0, io.EOF
+		} else {
+			pb.cond.Wait()
+		}
+	}
+}
+
+// deliver moves the bytes in transit that have arrived to the read buffer.
+func (pb *pipeBuffer) deliver() {
+	if len(pb.transit) == 0 {
+		return
+	}
+	elapsed := time.Since(pb.next)
+	if elapsed < 0 {
+		return
+	}
+	n := int(elapsed/pb.cfg.ByteDelay) + 1
+	if n > len(pb.transit) {
+		n = len(pb.transit)
+	}
+	pb.buf.Write(pb.transit[:n])
+	pb.transit = pb.transit[n:]
+	pb.next = pb.next.Add(time.Duration(n) * pb.cfg.ByteDelay)
+}
+
+func (pb *pipeBuffer) write(b []byte) (int, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.closed {
+		return 0, io.ErrClosedPipe
+	}
+	data := pb.corrupt(b)
+	if pb.cfg.ByteDelay == 0 {
+		pb.buf.Write(data)
+	} else {
+		pb.deliver()
+		if len(pb.transit) == 0 {
+			// Line is idle, first byte arrives after its transmission time.
+			if first := time.Now().Add(pb.cfg.ByteDelay); pb.next.Before(first) {
+				pb.next = first
+			}
+		}
+		pb.transit = append(pb.transit, data...)
+	}
+	pb.cond.Broadcast()
+	return len(b), nil
+}
+
+// corrupt returns b with bytes dropped and bits flipped according to the configuration.
+// b is returned unmodified if no errors are configured.
+func (pb *pipeBuffer) corrupt(b []byte) []byte {
+	if pb.cfg.BitErrorRate == 0 && pb.cfg.DropRate == 0 {
+		return b
+	}
+	data := make([]byte, 0, len(b))
+	for _, c := range b {
+		if pb.cfg.DropRate > 0 && pb.rng.Float64() < pb.cfg.DropRate {
+			continue
+		}
+		for bit := 0; bit < 8 && pb.cfg.BitErrorRate > 0; bit++ {
+			if pb.rng.Float64() < pb.cfg.BitErrorRate {
+				c ^= 1 << bit
+			}
+		}
+		data = append(data, c)
+	}
+	return data
+}
+
+func (pb *pipeBuffer) close() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.closed = true
+	pb.cond.Broadcast()
+}
@@ -0,0 +1,196 @@
+package cereal
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Poller drives the readers of many [NonBlocking] ports from a single goroutine instead of one goroutine
+// per port, which matters when opening hundreds of ports such as on test fixtures with many devices.
+// Ports are read in turn, each with its own backoff: a port that returns no data is read less often
+// until data arrives again.
+//
+// Since reads are performed one after the other, each read delays the reads of all other ports.
+// Ports must therefore return promptly when no data is available, i.e. be opened with a short
+// read timeout. A port whose Read blocks stalls the whole Poller.
+//
+// Poller is safe for concurrent use.
+type Poller struct {
+	mu     sync.Mutex
+	queue  pollQueue
+	ports  map[*NonBlocking]struct{}
+	closed bool
+	// wake is signalled when a port is scheduled so the goroutine re-evaluates its sleep.
+	wake chan struct{}
+	// stop is closed by Close and exited is closed once the goroutine returns.
+	stop   chan struct{}
+	exited chan struct{}
+}
+
+// NewPoller returns a Poller and starts its goroutine. Call Close to stop it.
+func NewPoller() *Poller {
+	p := &Poller{
+		ports:  make(map[*NonBlocking]struct{}),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// NewNonBlocking is like the package level [NewNonBlocking] but returns a NonBlocking whose reader
+// is driven by the Poller instead of a dedicated goroutine. The returned NonBlocking has the same API
+// and semantics. It is removed from the Poller once its reader terminates, i.e. after Close.
+// Ports created after the Poller is closed are closed immediately.
+func (p *Poller) NewNonBlocking(rwc io.ReadWriteCloser, cfg NonBlockingConfig) *NonBlocking {
+	nb := newNonBlocking(rwc, cfg)
+	nb.poller = p
+	p.mu.Lock()
+	closed := p.closed
+	if !closed {
+		p.ports[nb] = struct{}{}
+	}
+	p.mu.Unlock()
+	if closed {
+		nb.Close()
+		return nb
+	}
+	if !cfg.LazyStart {
+		nb.start()
+	}
+	return nb
+}
+
+// Len returns the amount of ports driven by the Poller.
+func (p *Poller) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.ports)
+}
+
+// Close stops the Poller's goroutine and closes all its ports.
+// It returns the errors returned by closing the ports.
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errPollerClosed
+	}
+	p.closed = true
+	ports := p.ports
+	p.ports = nil
+	p.mu.Unlock()
+	close(p.stop)
+	<-p.exited
+	var errs []error
+	for nb := range ports {
+		errs = append(errs, nb.Close())
+		select {
+		case <-nb.done:
+		default:
+			// The reader was scheduled and will never be stepped again.
+			nb.readerDone()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var errPollerClosed = errors.New("poller closed")
+
+// schedule adds nb's reader to the queue to be read immediately.
+func (p *Poller) schedule(nb *NonBlocking) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return // Close takes care of terminating the reader.
+	}
+	heap.Push(&p.queue, &pollEntry{nb: nb, st: newReadState(), next: time.Now()})
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Poller) run() {
+	defer close(p.exited)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		p.mu.Lock()
+		var wait time.Duration = -1
+		var e *pollEntry
+		if len(p.queue) > 0 {
+			wait = time.Until(p.queue[0].next)
+			if wait <= 0 {
+				e = heap.Pop(&p.queue).(*pollEntry)
+			}
+		}
+		p.mu.Unlock()
+		if e == nil {
+			var timeout <-chan time.Time
+			if wait > 0 {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(wait)
+				timeout = timer.C
+			}
+			select {
+			case <-p.stop:
+				return
+			case <-p.wake:
+			case <-timeout:
+			}
+			continue
+		}
+		wait, done := p.step(e)
+		if done {
+			p.mu.Lock()
+			delete(p.ports, e.nb)
+			p.mu.Unlock()
+			e.nb.readerDone()
+			continue
+		}
+		e.next = time.Now().Add(wait)
+		p.mu.Lock()
+		if !p.closed {
+			heap.Push(&p.queue, e)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// step performs a read of e's reader. A panic in the reader terminates the reader on the next step.
+func (p *Poller) step(e *pollEntry) (wait time.Duration, done bool) {
+	defer e.nb.recoverReader()
+	return e.nb.readStep(e.st)
+}
+
+type pollEntry struct {
+	nb   *NonBlocking
+	st   *readState
+	next time.Time
+}
+
+// pollQueue is a min-heap of readers ordered by the time of their next read.
+type pollQueue []*pollEntry
+
+func (q pollQueue) Len() int           { return len(q) }
+func (q pollQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q pollQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pollQueue) Push(x any)        { *q = append(*q, x.(*pollEntry)) }
+func (q *pollQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
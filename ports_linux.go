@@ -0,0 +1,93 @@
+//go:build linux
+
+package cereal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// stablePortNames returns a map of device node to its /dev/serial/by-id link.
+func stablePortNames() map[string]string {
+	const byID = "/dev/serial/by-id"
+	entries, err := os.ReadDir(byID)
+	if err != nil {
+		return nil // Directory does not exist when no USB serial devices are connected.
+	}
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		link := filepath.Join(byID, entry.Name())
+		dev, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		names[dev] = link
+	}
+	return names
+}
+
+// usbInterfaceDir returns the sysfs directory of the USB interface the tty device node
+// belongs to, i.e. /sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.3/1-2.3:1.0.
+// It returns an empty string if the device is not a USB device.
+func usbInterfaceDir(devname string) string {
+	dev, err := filepath.EvalSymlinks(filepath.Join("/sys/class/tty", filepath.Base(devname), "device"))
+	if err != nil {
+		return ""
+	}
+	for dir := dev; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		// USB interfaces are named bus-port.port:config.interface. PCI devices contain colons but no dash.
+		if base := filepath.Base(dir); strings.Contains(base, ":") && strings.Contains(base, "-") {
+			return dir
+		}
+	}
+	return ""
+}
+
+// usbLocation returns the USB bus and port chain of the device, i.e. "1-2.3"
+// for port 3 of the hub connected to port 2 of bus 1.
+func usbLocation(devname string) string {
+	dir := usbInterfaceDir(devname)
+	if dir == "" {
+		return ""
+	}
+	location, _, _ := strings.Cut(filepath.Base(dir), ":")
+	return location
+}
+
+// usbInterfaceNumber returns the number of the USB interface of the device
+// within its USB device, or -1 if the device is not a USB device.
+func usbInterfaceNumber(devname string) int {
+	dir := usbInterfaceDir(devname)
+	if dir == "" {
+		return -1
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "bInterfaceNumber"))
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 16, 8)
+	if err != nil {
+		return -1
+	}
+	return int(n)
+}
+
+// setLatencyTimer sets the latency timer in milliseconds of the USB serial adapter
+// the file descriptor belongs to through sysfs.
+func setLatencyTimer(fd uintptr, ms int) error {
+	dev, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		return err
+	}
+	name := filepath.Join("/sys/bus/usb-serial/devices", filepath.Base(dev), "latency_timer")
+	err = os.WriteFile(name, []byte(strconv.Itoa(ms)), 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: latency timer for %s", ErrNotSupported, dev)
+	}
+	return err
+}
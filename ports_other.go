@@ -0,0 +1,27 @@
+//go:build !linux
+
+package cereal
+
+// stablePortNames returns a map of device name to a stable name for the device.
+// Stable names are only supported on Linux.
+func stablePortNames() map[string]string {
+	return nil
+}
+
+// usbLocation returns the USB bus and port chain of the device.
+// USB locations are only supported on Linux.
+func usbLocation(devname string) string {
+	return ""
+}
+
+// usbInterfaceNumber returns the number of the USB interface of the device.
+// USB interface numbers are only supported on Linux.
+func usbInterfaceNumber(devname string) int {
+	return -1
+}
+
+// setLatencyTimer sets the latency timer of the USB serial adapter.
+// Latency timers are only supported on Linux.
+func setLatencyTimer(fd uintptr, ms int) error {
+	return ErrNotSupported
+}
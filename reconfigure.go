@@ -0,0 +1,227 @@
+package cereal
+
+import (
+	"errors"
+	"io"
+
+	"github.com/distributed/sers"
+	bugst "go.bug.st/serial"
+)
+
+// SetBaudRate changes the baud rate of an open port, keeping the rest of its configuration.
+// This is useful for protocols that negotiate a higher baud rate after a handshake.
+// Supported ports are those that implement `SetBaudRate(int) error`, sers and bugst ports,
+// and ports with a file descriptor (see [FileDescriptor]) where the [Termios] Opener is available.
+// Ports wrapped by a [NonBlocking] or other wrappers are also supported. [ErrNotSupported] is returned otherwise.
+//
+// Pending output of bugst ports and ports reconfigured by file descriptor is drained before
+// changing the baud rate. Bytes already received and buffered, by the OS or by a NonBlocking,
+// were transmitted at the old baud rate.
+func SetBaudRate(port io.ReadWriteCloser, baud int) error {
+	if baud <= 0 {
+		return errors.New("invalid baud rate")
+	}
+	type baudSetter interface {
+		SetBaudRate(int) error
+	}
+	switch p := unwrapPort(port).(type) {
+	case baudSetter:
+		return p.SetBaudRate(baud)
+	case *bugstPort:
+		return p.setMode(func(mode Mode) Mode {
+			mode.BaudRate = baud
+			return mode
+		})
+	case sers.SerialPort:
+		smode, err := p.GetMode()
+		if err != nil {
+			return err
+		}
+		smode.Baudrate = baud
+		return sers.SetModeStruct(p, smode)
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	return setTermiosBaudRate(fd, baud)
+}
+
+// SetMode reconfigures the baud rate, data bits, parity and stop bits of an open port. This is useful
+// for trying multiple settings against the same port without reopening it, i.e. for auto-baud detection.
+// Supported ports are those that implement `SetMode(Mode) error`, sers and bugst ports, and ports
+// with a file descriptor (see [FileDescriptor]) where the [Termios] Opener is available.
+// Ports wrapped by a [NonBlocking] or other wrappers are also supported. [ErrNotSupported] is returned otherwise.
+// The same limitations on mode apply as when opening the port with the corresponding Opener.
+// The read timeout of ports reconfigured by file descriptor can't be changed, so mode.ReadTimeout must be zero.
+//
+// Pending output of bugst ports and ports reconfigured by file descriptor is drained before
+// changing the mode. Bytes already received and buffered, by the OS or by a NonBlocking,
+// were received with the old mode.
+func SetMode(port io.ReadWriteCloser, mode Mode) error {
+	mode, err := mode.withDefaults()
+	if err != nil {
+		return err
+	}
+	type modeSetter interface {
+		SetMode(Mode) error
+	}
+	switch p := unwrapPort(port).(type) {
+	case modeSetter:
+		return p.SetMode(mode)
+	case *bugstPort:
+		if mode.ReadTimeout != 0 {
+			return errUnsupportedReadTimeout
+		}
+		return p.setMode(func(m Mode) Mode {
+			m.BaudRate, m.DataBits, m.Parity, m.StopBits = mode.BaudRate, mode.DataBits, mode.Parity, mode.StopBits
+			return m
+		})
+	case sers.SerialPort:
+		smode, err := sersMode(mode)
+		if err != nil {
+			return err
+		}
+		err = sers.SetModeStruct(p, smode)
+		if err != nil {
+			return err
+		}
+		if mode.ReadTimeout != 0 {
+			return p.SetReadParams(0, mode.ReadTimeout.Seconds())
+		}
+		return nil
+	case bugst.Port:
+		if mode.ReadTimeout != 0 {
+			return errUnsupportedReadTimeout
+		}
+		bmode, err := bugstMode(mode)
+		if err != nil {
+			return err
+		}
+		err = p.Drain()
+		if err != nil {
+			return err
+		}
+		return p.SetMode(bmode)
+	}
+	fd, err := fileDescriptor(port)
+	if err != nil {
+		return err
+	}
+	if mode.ReadTimeout != 0 {
+		return errUnsupportedReadTimeout
+	}
+	err = (Termios{}).Capabilities().check(mode)
+	if err != nil {
+		return err
+	}
+	return setTermiosMode(fd, mode)
+}
+
+// SetParity changes the parity of an open port, keeping the rest of its configuration. This is useful
+// for industrial protocols that switch parity mid-session. Pending output is transmitted with the old
+// parity while input received with the old parity, buffered by the OS or by a NonBlocking wrapping port,
+// is discarded so that bytes framed differently are not mixed.
+//
+// If port implements `SetParity(Parity) error` it is called instead and is responsible for discarding
+// the OS input. bugst ports are reconfigured with the mode they were opened with. Otherwise the port is
+// reconfigured using its file descriptor, which is only supported on Linux. [ErrNotSupported] is returned otherwise.
+func SetParity(port io.ReadWriteCloser, parity Parity) error {
+	var err error
+	if p, ok := unwrapPort(port).(interface{ SetParity(Parity) error }); ok {
+		err = p.SetParity(parity)
+	} else if bp, ok := unwrapPort(port).(*bugstPort); ok {
+		err = bp.setMode(func(mode Mode) Mode {
+			mode.Parity = parity
+			return mode
+		})
+		if err == nil {
+			err = bp.ResetInputBuffer()
+		}
+	} else {
+		var fd uintptr
+		fd, err = fileDescriptor(port)
+		if err != nil {
+			return err
+		}
+		err = setTermiosParity(fd, parity)
+	}
+	if err != nil {
+		return err
+	}
+	resetNonBlocking(port)
+	return nil
+}
+
+// SetStopBits changes the stop bits of an open port, keeping the rest of its configuration.
+// It works as [SetParity], calling `SetStopBits(StopBits) error` if implemented by port.
+func SetStopBits(port io.ReadWriteCloser, stopBits StopBits) error {
+	var err error
+	if p, ok := unwrapPort(port).(interface{ SetStopBits(StopBits) error }); ok {
+		err = p.SetStopBits(stopBits)
+	} else if bp, ok := unwrapPort(port).(*bugstPort); ok {
+		err = bp.setMode(func(mode Mode) Mode {
+			mode.StopBits = stopBits
+			return mode
+		})
+		if err == nil {
+			err = bp.ResetInputBuffer()
+		}
+	} else {
+		var fd uintptr
+		fd, err = fileDescriptor(port)
+		if err != nil {
+			return err
+		}
+		err = setTermiosStopBits(fd, stopBits)
+	}
+	if err != nil {
+		return err
+	}
+	resetNonBlocking(port)
+	return nil
+}
+
+// resetNonBlocking discards the data buffered by the NonBlockings wrapping port, if any.
+func resetNonBlocking(port io.ReadWriteCloser) {
+	for {
+		if nb, ok := port.(*NonBlocking); ok {
+			nb.Reset()
+		}
+		u, ok := port.(underlyingPort)
+		if !ok {
+			return
+		}
+		port = u.Underlying()
+	}
+}
+
+// ErrBaudNotDetected is returned by [DetectBaud] when no candidate baud rate was accepted by the probe.
+var ErrBaudNotDetected = errors.New("cereal: baud rate not detected")
+
+// DetectBaud opens the port with each of the candidate baud rates in order, with 8 data bits,
+// no parity and 1 stop bit, and calls probe with the open port. It returns the first baud rate for which
+// probe returns true. The port is closed after each probe. probe typically writes a command
+// and checks that the response is valid (not garbage), so it should wrap the port with a [NonBlocking]
+// or similar to avoid blocking forever on a non-responsive device.
+//
+// Candidates that fail to open are skipped. If no candidate is accepted [ErrBaudNotDetected] is returned
+// joined with the errors encountered opening or closing the port.
+func DetectBaud(o Opener, name string, candidates []int, probe func(io.ReadWriteCloser) bool) (int, error) {
+	var errs []error
+	for _, baud := range candidates {
+		port, err := o.OpenPort(name, Mode{BaudRate: baud, DataBits: 8})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ok := probe(port)
+		err = port.Close()
+		if ok {
+			return baud, nil
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return 0, errors.Join(append([]error{ErrBaudNotDetected}, errs...)...)
+}
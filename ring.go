@@ -0,0 +1,96 @@
+package cereal
+
+import (
+	"errors"
+	"io"
+)
+
+var errRingFull = errors.New("ring buffer full")
+
+// ring is a fixed-capacity circular buffer implementing [Buffer].
+// Writes and reads are O(1) in the amount of bytes buffered and never reallocate.
+type ring struct {
+	buf []byte
+	// off is the index of the first byte to be read.
+	off int
+	// n is the amount of bytes buffered.
+	n int
+}
+
+func newRing(size int) *ring {
+	if size <= 0 {
+		panic("invalid ring size")
+	}
+	return &ring{buf: make([]byte, size)}
+}
+
+// Len returns the number of bytes buffered.
+func (r *ring) Len() int { return r.n }
+
+// Cap returns the total capacity of the ring.
+func (r *ring) Cap() int { return len(r.buf) }
+
+// Free returns the amount of bytes that can be written before the ring is full.
+func (r *ring) Free() int { return len(r.buf) - r.n }
+
+// Reset discards all buffered bytes.
+func (r *ring) Reset() {
+	r.off = 0
+	r.n = 0
+}
+
+// Write writes as many bytes of b as fit in the ring. If not all of b fit
+// then errRingFull is returned along with the amount of bytes written.
+func (r *ring) Write(b []byte) (int, error) {
+	full := len(b) > r.Free()
+	if full {
+		b = b[:r.Free()]
+	}
+	end := (r.off + r.n) % len(r.buf)
+	n := copy(r.buf[end:], b)
+	n += copy(r.buf, b[n:])
+	r.n += n
+	if full {
+		return n, errRingFull
+	}
+	return n, nil
+}
+
+// Read reads buffered bytes into b. If the ring is empty and len(b) > 0 then io.EOF is returned.
+func (r *ring) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	if len(b) > r.n {
+		b = b[:r.n]
+	}
+	n := copy(b, r.buf[r.off:])
+	n += copy(b[n:], r.buf)
+	r.off = (r.off + n) % len(r.buf)
+	r.n -= n
+	if r.n == 0 {
+		r.off = 0 // Keep subsequent writes contiguous.
+	}
+	return n, nil
+}
+
+// peek copies buffered bytes into b without consuming them and returns the amount copied.
+func (r *ring) peek(b []byte) int {
+	if len(b) > r.n {
+		b = b[:r.n]
+	}
+	n := copy(b, r.buf[r.off:])
+	n += copy(b[n:], r.buf)
+	return n
+}
+
+// unread inserts b before the buffered bytes so that it is read first. b must fit in the free space.
+func (r *ring) unread(b []byte) {
+	r.off = (r.off - len(b) + len(r.buf)) % len(r.buf)
+	n := copy(r.buf[r.off:], b)
+	copy(r.buf, b[n:])
+	r.n += len(b)
+}
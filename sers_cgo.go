@@ -1,9 +1,13 @@
-//go:build cgo
+//go:build cgo && !darwin && (!linux || ppc || ppc64 || ppc64le)
 
 package cereal
 
 import "github.com/distributed/sers"
 
-func openSers(portname string) (sers.SerialPort, error) {
-	return sers.Open(portname)
+const sersAvailable = true
+
+// openSers opens portname with sers. The descriptor of the port is not known so -1 is returned.
+func openSers(portname string, readTimeout bool) (sers.SerialPort, int, error) {
+	sp, err := sers.Open(portname)
+	return sp, -1, err
 }
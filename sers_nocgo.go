@@ -10,6 +10,8 @@ import (
 
 var serserr = errors.New("github.com/distributed/sers.OpenPort requires CGO")
 
-func openSers(portname string) (sers.SerialPort, error) {
-	return nil, serserr
+const sersAvailable = false
+
+func openSers(portname string, readTimeout bool) (sers.SerialPort, int, error) {
+	return nil, -1, serserr
 }
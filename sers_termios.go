@@ -0,0 +1,42 @@
+//go:build cgo && (darwin || (linux && !ppc && !ppc64 && !ppc64le))
+
+package cereal
+
+import (
+	"os"
+
+	"github.com/distributed/sers"
+	"golang.org/x/sys/unix"
+)
+
+const sersAvailable = true
+
+// openSers opens portname as sers.Open does and hands the descriptor to sers with TakeOver,
+// so that the descriptor of the port is known. It returns the port and its descriptor.
+// The descriptor is left blocking if the port is opened with a read timeout.
+func openSers(portname string, readTimeout bool) (sers.SerialPort, int, error) {
+	// O_NONBLOCK prevents open from blocking until carrier detect is asserted.
+	fd, err := unix.Open(portname, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, -1, &os.PathError{Op: "open", Path: portname, Err: err}
+	}
+	err = makeRaw(fd)
+	if err == nil && readTimeout {
+		// The VTIME timeout set by SetReadParams only applies to blocking reads.
+		err = unix.SetNonblock(fd, false)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, -1, err
+	}
+	// The file of a descriptor that is already non-blocking reads through the runtime poller and
+	// stays non-blocking when TakeOver calls its Fd method, as the file created by sers.Open.
+	// Otherwise reads block in the kernel and are bounded by VTIME.
+	f := os.NewFile(uintptr(fd), portname)
+	sp, err := sers.TakeOver(f)
+	if err != nil {
+		f.Close()
+		return nil, -1, err
+	}
+	return sp, fd, nil
+}
@@ -0,0 +1,24 @@
+package cereal
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+	// ioctlSetTermiosDrain sets the terminal attributes once pending output has been transmitted.
+	ioctlSetTermiosDrain = unix.TIOCSETAW
+	// cflagMarkSpace is zero since Darwin has no sticky parity.
+	cflagMarkSpace = 0
+)
+
+// setTermiosSpeed sets the input and output baud rate. Darwin stores the rate
+// as a number but drivers may reject rates that are not standard.
+func setTermiosSpeed(tio *unix.Termios, baud int) {
+	tio.Ispeed = uint64(baud)
+	tio.Ospeed = uint64(baud)
+}
+
+// setMarkSpaceParity returns an error since Darwin has no sticky parity.
+func setMarkSpaceParity(tio *unix.Termios, mark bool) error {
+	return errUnsupportedParity
+}
@@ -0,0 +1,32 @@
+//go:build linux && !ppc && !ppc64 && !ppc64le
+
+package cereal
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TCGETS2
+	ioctlSetTermios = unix.TCSETS2
+	// ioctlSetTermiosDrain sets the terminal attributes once pending output has been transmitted.
+	ioctlSetTermiosDrain = unix.TCSETSW2
+	// cflagMarkSpace is the sticky parity flag, cleared along with the other parity flags.
+	cflagMarkSpace = unix.CMSPAR
+)
+
+// setTermiosSpeed sets an arbitrary input and output baud rate.
+func setTermiosSpeed(tio *unix.Termios, baud int) {
+	tio.Cflag &^= unix.CBAUD
+	tio.Cflag |= unix.BOTHER
+	tio.Ispeed = uint32(baud)
+	tio.Ospeed = uint32(baud)
+}
+
+// setMarkSpaceParity sets sticky parity so the parity bit is always 1 for mark or 0 for space.
+func setMarkSpaceParity(tio *unix.Termios, mark bool) error {
+	tio.Cflag &^= unix.PARODD
+	tio.Cflag |= unix.PARENB | unix.CMSPAR
+	if mark {
+		tio.Cflag |= unix.PARODD
+	}
+	return nil
+}
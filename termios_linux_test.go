@@ -0,0 +1,604 @@
+//go:build linux && !ppc && !ppc64 && !ppc64le
+
+package cereal_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/soypat/cereal"
+	bugst "go.bug.st/serial"
+	"golang.org/x/sys/unix"
+)
+
+// openPty returns the master of a new pseudoterminal and the path of its slave.
+func openPty(t *testing.T) (master *os.File, slave string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { master.Close() })
+	fd := int(master.Fd())
+	err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, "/dev/pts/" + strconv.Itoa(n)
+}
+
+// skipUnavailable skips the test if the backend of o can't open ports in the current build.
+func skipUnavailable(t *testing.T, o cereal.Opener) {
+	t.Helper()
+	if a, ok := o.(interface{ Available() bool }); ok && !a.Available() {
+		t.Skip("backend not available")
+	}
+}
+
+func TestTermiosReadTimeout(t *testing.T) {
+	master, slave := openPty(t)
+	const timeout = 100 * time.Millisecond
+	port, err := cereal.Termios{}.OpenPort(slave, cereal.Mode{BaudRate: 9600, ReadTimeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	buf := make([]byte, 16)
+	start := time.Now()
+	n, err := port.Read(buf)
+	if elapsed := time.Since(start); n != 0 || !errors.Is(err, cereal.ErrReadTimeout) || elapsed < timeout/2 {
+		t.Fatalf("expected read to time out in the kernel, got %d, %v after %s", n, err, elapsed)
+	}
+	_, err = master.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = port.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected to read written data, got %q, %v", buf[:n], err)
+	}
+}
+
+// TestReadTimeoutConformance checks all backends implement the semantics of Mode.ReadTimeout.
+func TestReadTimeoutConformance(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			master, slave := openPty(t)
+			port, err := cereal.OpenWithTimeout(o, slave, cereal.Mode{BaudRate: 9600, ReadTimeout: timeout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer port.Close()
+			buf := make([]byte, 16)
+			expectTimeout := func() {
+				t.Helper()
+				start := time.Now()
+				n, err := port.Read(buf)
+				if elapsed := time.Since(start); n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) || elapsed < timeout/2 {
+					t.Fatalf("expected read to time out after %s, got %d, %v after %s", timeout, n, err, elapsed)
+				}
+			}
+			expectTimeout()
+			_, err = master.Write([]byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(timeout / 4)
+			// Received data is returned without waiting to fill buf.
+			var got []byte
+			start := time.Now()
+			for len(got) < 5 {
+				n, err := port.Read(buf)
+				if err != nil {
+					t.Fatalf("expected data after reading %q, got %v", got, err)
+				}
+				got = append(got, buf[:n]...)
+			}
+			if string(got) != "hello" || time.Since(start) > timeout/2 {
+				t.Fatalf("expected to read written data promptly, got %q after %s", got, time.Since(start))
+			}
+			// The port remains usable after a timeout.
+			expectTimeout()
+		})
+	}
+}
+
+// TestReadTimeoutHangup checks a hang up is not mistaken for a read timeout by any backend.
+func TestReadTimeoutHangup(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			master, slave := openPty(t)
+			port, err := cereal.OpenWithTimeout(o, slave, cereal.Mode{BaudRate: 9600, ReadTimeout: 100 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+			defer nb.Close()
+			master.Close()
+			_, err = nb.ReadDeadline(make([]byte, 16), time.Now().Add(2*time.Second))
+			if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("expected reader to stop with an error after hang up, got", err)
+			}
+		})
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			_, slave := openPty(t)
+			mode := cereal.Mode{BaudRate: 9600, Exclusive: true}
+			port, err := o.OpenPort(slave, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer port.Close()
+			// Unprivileged opens fail with EBUSY due to TIOCEXCL, root's reach the flock.
+			second, err := o.OpenPort(slave, mode)
+			if err == nil {
+				second.Close()
+			}
+			if !errors.Is(err, cereal.ErrPortBusy) {
+				t.Fatal("expected ErrPortBusy opening port twice, got", err)
+			}
+		})
+	}
+}
+
+func TestFileDescriptorBackends(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			// Only Termios and Sers expose their descriptor. The other Openers open one when the mode requires it.
+			_, exposed := o.(cereal.Termios)
+			if _, ok := o.(cereal.Sers); ok {
+				exposed = true
+			}
+			for _, mode := range []cereal.Mode{{BaudRate: 19200}, {BaudRate: 19200, NoResetOnOpen: true}} {
+				_, slave := openPty(t)
+				port, err := o.OpenPort(slave, mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fd, err := cereal.FileDescriptor(port)
+				if !exposed && !mode.NoResetOnOpen {
+					port.Close()
+					if !errors.Is(err, cereal.ErrNotSupported) {
+						t.Error("expected ErrNotSupported for port without descriptor, got", err)
+					}
+					continue
+				} else if err != nil {
+					port.Close()
+					t.Fatal(err)
+				}
+				tio, err := unix.IoctlGetTermios(int(fd), unix.TCGETS2)
+				if err != nil {
+					port.Close()
+					t.Fatal(err)
+				}
+				if tio.Ospeed != 19200 {
+					t.Errorf("expected descriptor of port configured at 19200 baud, got %d", tio.Ospeed)
+				}
+				port.Close()
+				if _, err = unix.IoctlGetTermios(int(fd), unix.TCGETS); !errors.Is(err, unix.EBADF) {
+					t.Error("expected descriptor to be closed with port, got", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	type capOpener interface {
+		cereal.Opener
+		Capabilities() cereal.Capabilities
+		Available() bool
+	}
+	base := cereal.Mode{BaudRate: 9600, DataBits: 8, StopBits: cereal.StopBits1}
+	for _, o := range []capOpener{cereal.Bugst{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Termios{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			if !o.Available() {
+				t.Skip("backend not available")
+			}
+			caps := o.Capabilities()
+			var tests = []struct {
+				name      string
+				supported bool
+				mode      func(m cereal.Mode) cereal.Mode
+			}{
+				{"read timeout", caps.SupportsReadTimeout, func(m cereal.Mode) cereal.Mode { m.ReadTimeout = time.Second; return m }},
+				{"mark parity", caps.SupportsMarkSpaceParity, func(m cereal.Mode) cereal.Mode { m.Parity = cereal.ParityMark; return m }},
+				{"space parity", caps.SupportsMarkSpaceParity, func(m cereal.Mode) cereal.Mode { m.Parity = cereal.ParitySpace; return m }},
+				// Termios only supports 1.5 stop bits with 5 data bits.
+				{"1.5 stop bits", caps.Supports1HalfStopBits, func(m cereal.Mode) cereal.Mode {
+					m.DataBits = 5
+					m.StopBits = cereal.StopBits1Half
+					return m
+				}},
+			}
+			for _, test := range tests {
+				mode := test.mode(base)
+				if caps.Supports(mode) != test.supported {
+					t.Errorf("%s: Supports disagrees with capabilities", test.name)
+				}
+				_, slave := openPty(t)
+				port, err := o.OpenPort(slave, mode)
+				if err == nil {
+					port.Close()
+				}
+				if test.supported && err != nil {
+					t.Errorf("%s: declared supported but open failed: %v", test.name, err)
+				} else if !test.supported && !errors.Is(err, cereal.ErrNotSupported) {
+					t.Errorf("%s: declared unsupported, expected ErrNotSupported opening port, got %v", test.name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTermiosMaxReadSize(t *testing.T) {
+	master, slave := openPty(t)
+	port, err := cereal.Termios{MaxReadSize: 4}.OpenPort(slave, cereal.Mode{BaudRate: 9600, ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	// The read must wait for MaxReadSize bytes instead of returning the first byte.
+	go func() {
+		master.Write([]byte("ab"))
+		time.Sleep(50 * time.Millisecond)
+		master.Write([]byte("cd"))
+	}()
+	buf := make([]byte, 16)
+	n, err := port.Read(buf)
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Fatalf("expected to read 4 bytes at once, got %q, %v", buf[:n], err)
+	}
+}
+
+func TestNonBlockingPoll(t *testing.T) {
+	master, slave := openPty(t)
+	port, err := cereal.Termios{}.OpenPort(slave, cereal.Mode{BaudRate: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb := cereal.NewNonBlockingPoll(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	time.Sleep(200 * time.Millisecond)
+	if stats := nb.Stats(); stats.EmptyReads != 0 || stats.BackoffSleeps != 0 {
+		t.Fatalf("expected no reads while idle, got %+v", stats)
+	}
+	_, err = master.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	n, err := nb.ReadDeadline(buf, time.Now().Add(time.Second))
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected to read written data, got %q, %v", buf[:n], err)
+	}
+	err = nb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-nb.Done():
+	case <-time.After(time.Second):
+		t.Fatal("reader did not terminate after Close")
+	}
+}
+
+func TestMaxWriteChunk(t *testing.T) {
+	master, slave := openPty(t)
+	mode := cereal.Mode{BaudRate: 9600, MaxWriteChunk: 10, InterChunkDelay: 20 * time.Millisecond}
+	port, err := cereal.Termios{}.OpenPort(slave, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	data := []byte("0123456789abcdefghijABCDEFGHIJ")
+	start := time.Now()
+	n, err := port.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("expected to write %d bytes, got %d, %v", len(data), n, err)
+	}
+	// Two pauses between three chunks.
+	if elapsed, want := time.Since(start), 2*(mode.TransmitDuration(10)+mode.InterChunkDelay); elapsed < want {
+		t.Errorf("expected write to take at least %s, took %s", want, elapsed)
+	}
+	err = cereal.WaitDrain(port, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(data))
+	_, err = io.ReadFull(master, got)
+	if err != nil || string(got) != string(data) {
+		t.Fatalf("expected to read %q, got %q, %v", data, got, err)
+	}
+}
+
+func TestFromFd(t *testing.T) {
+	master, slave := openPty(t)
+	fd, err := unix.Open(slave, unix.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := cereal.FromFd(uintptr(fd), cereal.Mode{BaudRate: 9600, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		unix.Close(fd)
+		t.Fatal(err)
+	}
+	defer port.Close()
+	if name, _ := cereal.PortName(port); name != "/dev/fd/"+strconv.Itoa(fd) {
+		t.Errorf("unexpected port name %q", name)
+	}
+	// The terminal must be in raw mode: no echo and no line buffering.
+	_, err = master.Write([]byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(port, buf)
+	if err != nil || string(buf) != "hi" {
+		t.Fatalf("expected to read written data, got %q, %v", buf, err)
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	_, slave := openPty(t)
+	port, err := cereal.Bugst{}.OpenPort(slave, cereal.Mode{BaudRate: 9600, WriteTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	if _, ok := port.(bugst.Port); ok {
+		t.Fatal("expected opened port to be wrapped")
+	}
+	bp, ok := cereal.Unwrap(nb).(bugst.Port)
+	if !ok {
+		t.Fatalf("expected bugst port, got %T", cereal.Unwrap(nb))
+	}
+	if err := bp.ResetInputBuffer(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNoResetOnOpen(t *testing.T) {
+	_, slave := openPty(t)
+	hupcl := func(noReset bool, set bool) bool {
+		port, err := cereal.Termios{}.OpenPort(slave, cereal.Mode{BaudRate: 9600, NoResetOnOpen: noReset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer port.Close()
+		fd, err := cereal.FileDescriptor(port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tio, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set {
+			tio.Cflag |= unix.HUPCL
+			err = unix.IoctlSetTermios(int(fd), unix.TCSETS, tio)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return tio.Cflag&unix.HUPCL != 0
+	}
+	hupcl(false, true)
+	if !hupcl(false, false) {
+		t.Fatal("expected HUPCL to persist across opens")
+	}
+	if hupcl(true, false) {
+		t.Error("expected NoResetOnOpen to clear HUPCL")
+	}
+}
+
+func TestTermiosClearsMarkSpaceParity(t *testing.T) {
+	_, slave := openPty(t)
+	// Leave the port in mark parity as a previous user might have.
+	f, err := os.OpenFile(slave, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tio, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tio.Cflag |= unix.PARENB | unix.PARODD | unix.CMSPAR
+	err = unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS, tio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tio, err = unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS); err != nil || tio.Cflag&unix.CMSPAR == 0 {
+		t.Skip("pseudoterminal does not keep CMSPAR", err)
+	}
+	port, err := cereal.Termios{}.OpenPort(slave, cereal.Mode{BaudRate: 9600, Parity: cereal.ParityEven})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	tio, err = unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tio.Cflag&unix.CMSPAR != 0 {
+		t.Errorf("expected CMSPAR cleared for even parity, got cflag %#o", tio.Cflag)
+	}
+}
+
+// TestReconfigureBackends checks the ports of all backends can be reconfigured through a NonBlocking.
+func TestReconfigureBackends(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			// tarm and goburrow ports are reconfigured by descriptor, which is only opened when the mode requires it.
+			_, needsDevice := o.(cereal.Tarm)
+			if _, ok := o.(cereal.Goburrow); ok {
+				needsDevice = true
+			}
+			for _, mode := range []cereal.Mode{{BaudRate: 9600}, {BaudRate: 9600, NoResetOnOpen: true}} {
+				master, slave := openPty(t)
+				port, err := o.OpenPort(slave, mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+				defer nb.Close()
+				err = cereal.SetBaudRate(nb, 57600)
+				if needsDevice && !mode.NoResetOnOpen {
+					if !errors.Is(err, cereal.ErrNotSupported) {
+						t.Error("expected ErrNotSupported setting baud rate of port without descriptor, got", err)
+					}
+					err = cereal.SetMode(nb, cereal.Mode{BaudRate: 38400})
+					if !errors.Is(err, cereal.ErrNotSupported) {
+						t.Error("expected ErrNotSupported setting mode of port without descriptor, got", err)
+					}
+					continue
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				// Pseudoterminals force 8 data bits and no parity so only the stop bits are checked.
+				expectTermios := func(baud, cflag uint32) {
+					t.Helper()
+					// The attributes of the master are those of the slave.
+					tio, err := unix.IoctlGetTermios(int(master.Fd()), unix.TCGETS2)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if tio.Ospeed != baud || tio.Cflag&unix.CSTOPB != cflag {
+						t.Errorf("expected %d baud and cflag %#o, got %d baud and cflag %#o", baud, cflag, tio.Ospeed, tio.Cflag&unix.CSTOPB)
+					}
+				}
+				expectTermios(57600, 0)
+				err = cereal.SetMode(nb, cereal.Mode{BaudRate: 38400, DataBits: 7, StopBits: cereal.StopBits2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectTermios(38400, unix.CSTOPB)
+				// The frame format set by SetMode is kept.
+				err = cereal.SetBaudRate(nb, 19200)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectTermios(19200, unix.CSTOPB)
+			}
+		})
+	}
+}
+
+// TestFlushAllBackends checks FlushAll discards the input received by the ports of all backends.
+func TestFlushAllBackends(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			// goburrow ports are flushed by descriptor, which is only opened when the mode requires it.
+			_, needsDevice := o.(cereal.Goburrow)
+			for _, mode := range []cereal.Mode{{BaudRate: 9600}, {BaudRate: 9600, NoResetOnOpen: true}} {
+				master, slave := openPty(t)
+				port, err := o.OpenPort(slave, mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{LazyStart: true})
+				defer nb.Close()
+				defer master.Close() // Hang up first so reads blocked in the kernel return.
+				_, err = master.Write([]byte("stale"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(50 * time.Millisecond) // Let the pseudoterminal deliver the data.
+				err = cereal.FlushAll(nb)
+				if needsDevice && !mode.NoResetOnOpen {
+					if !errors.Is(err, cereal.ErrNotSupported) {
+						t.Error("expected ErrNotSupported flushing port without descriptor, got", err)
+					}
+					continue
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				n, err := nb.ReadDeadline(make([]byte, 16), time.Now().Add(100*time.Millisecond))
+				if n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) {
+					t.Errorf("expected flushed input, read %d bytes, %v", n, err)
+				}
+			}
+		})
+	}
+}
+
+// TestSetReadBufferSizeBackends checks the ports of all backends report the buffer size can't be set.
+func TestSetReadBufferSizeBackends(t *testing.T) {
+	for _, o := range []cereal.Opener{cereal.Termios{}, cereal.Tarm{}, cereal.Goburrow{}, cereal.Sers{}, cereal.Bugst{}} {
+		t.Run(o.(fmt.Stringer).String(), func(t *testing.T) {
+			skipUnavailable(t, o)
+			_, slave := openPty(t)
+			port, err := o.OpenPort(slave, cereal.Mode{BaudRate: 9600})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer port.Close()
+			err = cereal.SetReadBufferSize(port, 65536)
+			if !errors.Is(err, cereal.ErrNotSupported) {
+				t.Error("expected ErrNotSupported, got", err)
+			}
+		})
+	}
+}
+
+func TestSetParityStopBits(t *testing.T) {
+	master, slave := openPty(t)
+	port, err := cereal.Termios{}.OpenPort(slave, cereal.Mode{BaudRate: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb := cereal.NewNonBlocking(port, cereal.NonBlockingConfig{})
+	defer nb.Close()
+	master.Write([]byte("old"))
+	if err := nb.WaitFor(3, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	err = cereal.SetParity(nb, cereal.ParityEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.Buffered() != 0 {
+		t.Error("expected data received with the old parity to be discarded")
+	}
+	err = cereal.SetStopBits(nb, cereal.StopBits2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cereal.SetStopBits(nb, cereal.StopBits1Half); !errors.Is(err, cereal.ErrNotSupported) {
+		t.Error("expected ErrNotSupported for 1.5 stop bits with 8 data bits, got", err)
+	}
+	fd, err := cereal.FileDescriptor(nb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tio, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pseudoterminals always clear PARENB so only the stop bits can be checked.
+	if tio.Cflag&unix.CSTOPB == 0 {
+		t.Errorf("unexpected cflag %#o", tio.Cflag)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !darwin && (!linux || ppc || ppc64 || ppc64le)
+
+package cereal
+
+import (
+	"fmt"
+	"io"
+)
+
+const termiosAvailable = false
+
+var errTermiosUnavailable = fmt.Errorf("%w: termios backend only available on linux and darwin", ErrNotSupported)
+
+func openTermios(portname string, mode Mode, maxReadSize int) (io.ReadWriteCloser, error) {
+	return nil, errTermiosUnavailable
+}
+
+func termiosFromFd(fd int, name string, mode Mode, maxReadSize int) (io.ReadWriteCloser, error) {
+	return nil, errTermiosUnavailable
+}
+
+func setTermiosMode(fd uintptr, mode Mode) error {
+	return errTermiosUnavailable
+}
+
+func setTermiosBaudRate(fd uintptr, baud int) error {
+	return errTermiosUnavailable
+}
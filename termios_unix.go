@@ -0,0 +1,219 @@
+//go:build darwin || (linux && !ppc && !ppc64 && !ppc64le)
+
+package cereal
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const termiosAvailable = true
+
+// termiosPort is a serial port configured by the Termios Opener.
+type termiosPort struct {
+	f  *os.File
+	fd int
+	// timeout is set when the port was opened with a read timeout, in which case
+	// reads block in the kernel with VTIME set to the timeout.
+	timeout bool
+}
+
+func (p *termiosPort) Read(b []byte) (int, error) {
+	n, err := p.f.Read(b)
+	if p.timeout && n == 0 && err == io.EOF {
+		// A VTIME read that times out returns no data, which os.File reports as EOF.
+		err = nil
+	}
+	return n, err
+}
+
+func (p *termiosPort) Write(b []byte) (int, error) { return p.f.Write(b) }
+
+func (p *termiosPort) Close() error { return p.f.Close() }
+
+// Fd returns the port's descriptor. Unlike os.File.Fd it leaves the descriptor in non-blocking mode.
+func (p *termiosPort) Fd() uintptr { return uintptr(p.fd) }
+
+func openTermios(portname string, mode Mode, maxReadSize int) (io.ReadWriteCloser, error) {
+	// O_NONBLOCK prevents open from blocking until carrier detect is asserted.
+	fd, err := unix.Open(portname, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: portname, Err: err}
+	}
+	port, err := newTermiosPort(fd, portname, mode, maxReadSize)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return port, nil
+}
+
+// termiosFromFd configures the open descriptor fd with mode. fd is not closed on error.
+func termiosFromFd(fd int, name string, mode Mode, maxReadSize int) (io.ReadWriteCloser, error) {
+	// The descriptor may have been inherited in blocking mode, see newTermiosPort.
+	err := unix.SetNonblock(fd, true)
+	if err != nil {
+		return nil, err
+	}
+	return newTermiosPort(fd, name, mode, maxReadSize)
+}
+
+// newTermiosPort configures the non-blocking descriptor fd with mode and returns it as a port.
+func newTermiosPort(fd int, name string, mode Mode, maxReadSize int) (*termiosPort, error) {
+	err := setTermios(fd, mode, maxReadSize)
+	if err == nil && mode.ReadTimeout > 0 {
+		// VMIN and VTIME only apply to blocking reads. Without a read timeout the descriptor
+		// is left non-blocking so that reads wait in the runtime poller and are interrupted by Close.
+		err = unix.SetNonblock(fd, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &termiosPort{
+		f:       os.NewFile(uintptr(fd), name),
+		fd:      fd,
+		timeout: mode.ReadTimeout > 0,
+	}, nil
+}
+
+// setTermios puts the terminal in raw mode with the frame format, baud rate and read timeout of mode.
+func setTermios(fd int, mode Mode, maxReadSize int) error {
+	tio, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	rawTermios(tio)
+	tio.Cflag |= unix.CREAD | unix.CLOCAL
+	err = setTermiosFrame(tio, mode)
+	if err != nil {
+		return err
+	}
+	vmin, vtime, err := termiosTimeout(mode.ReadTimeout, maxReadSize)
+	if err != nil {
+		return err
+	}
+	tio.Cc[unix.VMIN] = vmin
+	tio.Cc[unix.VTIME] = vtime
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, tio)
+}
+
+// setTermiosMode changes the baud rate and frame format of the terminal to those of mode once
+// pending output has been transmitted, keeping the rest of its configuration.
+func setTermiosMode(fd uintptr, mode Mode) error {
+	tio, err := unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	err = setTermiosFrame(tio, mode)
+	if err != nil {
+		return err
+	}
+	return unix.IoctlSetTermios(int(fd), ioctlSetTermiosDrain, tio)
+}
+
+// setTermiosBaudRate changes the baud rate of the terminal once pending output has been transmitted.
+func setTermiosBaudRate(fd uintptr, baud int) error {
+	tio, err := unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	setTermiosSpeed(tio, baud)
+	return unix.IoctlSetTermios(int(fd), ioctlSetTermiosDrain, tio)
+}
+
+// setTermiosFrame sets the baud rate and frame format of mode in tio, without flow control.
+func setTermiosFrame(tio *unix.Termios, mode Mode) error {
+	tio.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | cflagMarkSpace | unix.CSTOPB | unix.CRTSCTS
+	tio.Iflag &^= unix.INPCK
+	setTermiosSpeed(tio, mode.BaudRate)
+
+	switch mode.DataBits {
+	case 5:
+		tio.Cflag |= unix.CS5
+	case 6:
+		tio.Cflag |= unix.CS6
+	case 7:
+		tio.Cflag |= unix.CS7
+	case 8:
+		tio.Cflag |= unix.CS8
+	default:
+		return errInvalidDataBits
+	}
+
+	switch mode.Parity {
+	case ParityNone:
+	case ParityOdd:
+		tio.Cflag |= unix.PARENB | unix.PARODD
+	case ParityEven:
+		tio.Cflag |= unix.PARENB
+	case ParityMark, ParitySpace:
+		err := setMarkSpaceParity(tio, mode.Parity == ParityMark)
+		if err != nil {
+			return err
+		}
+	default:
+		return errInvalidParity
+	}
+	if mode.Parity != ParityNone {
+		tio.Iflag |= unix.INPCK
+	}
+
+	switch mode.StopBits {
+	case StopBits1:
+	case StopBits1Half:
+		// UARTs send 1.5 stop bits when two are requested with 5 bit characters.
+		if mode.DataBits != 5 {
+			return errUnsupportedStopbits
+		}
+		tio.Cflag |= unix.CSTOPB
+	case StopBits2:
+		tio.Cflag |= unix.CSTOPB
+	default:
+		return errInvalidStopbits
+	}
+	return nil
+}
+
+// makeRaw puts the terminal in raw mode with 8 bit characters and blocking reads waiting
+// for a single byte, like cfmakeraw.
+func makeRaw(fd int) error {
+	tio, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	rawTermios(tio)
+	tio.Cflag &^= unix.CSIZE | unix.PARENB
+	tio.Cflag |= unix.CS8
+	tio.Cc[unix.VMIN] = 1
+	tio.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, tio)
+}
+
+// rawTermios disables the input and output processing of the terminal, such as echo,
+// line editing, software flow control and newline translation.
+func rawTermios(tio *unix.Termios) {
+	tio.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR |
+		unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY | unix.INPCK
+	tio.Oflag &^= unix.OPOST
+	tio.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+}
+
+// termiosTimeout returns the VMIN and VTIME values for a read timeout. VTIME is
+// in tenths of a second so the timeout is rounded up to the next 100ms.
+// A non-zero maxReadSize sets VMIN, turning VTIME into an inter-byte timeout.
+func termiosTimeout(timeout time.Duration, maxReadSize int) (vmin, vtime uint8, err error) {
+	if timeout <= 0 {
+		return 1, 0, nil
+	}
+	deciseconds := (timeout + 100*time.Millisecond - 1) / (100 * time.Millisecond)
+	if deciseconds > 255 {
+		return 0, 0, errTermiosReadTimeout
+	}
+	if maxReadSize > 255 {
+		maxReadSize = 255
+	}
+	return uint8(maxReadSize), uint8(deciseconds), nil
+}